@@ -0,0 +1,118 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// SetFrom creates the From header with the specified from address.
+// It returns an error if from is not a valid RFC 5322 address.
+func (b *EmailBuilder) SetFrom(from string) error {
+	return b.setAddressStrings("From", []string{from})
+}
+
+// SetSender creates the Sender header with the specified sender address.
+// It returns an error if sender is not a valid RFC 5322 address.
+func (b *EmailBuilder) SetSender(sender string) error {
+	return b.setAddressStrings("Sender", []string{sender})
+}
+
+// SetTo creates the To header with the specified to addresses.
+// It returns an error if any of the addresses is not
+// a valid RFC 5322 address.
+func (b *EmailBuilder) SetTo(to []string) error {
+	return b.setAddressStrings("To", to)
+}
+
+// SetCc creates the Cc header with the specified cc addresses.
+// It returns an error if any of the addresses is not
+// a valid RFC 5322 address.
+func (b *EmailBuilder) SetCc(cc []string) error {
+	return b.setAddressStrings("Cc", cc)
+}
+
+// SetBcc creates the Bcc header with the specified bcc addresses.
+// It returns an error if any of the addresses is not
+// a valid RFC 5322 address.
+func (b *EmailBuilder) SetBcc(bcc []string) error {
+	return b.setAddressStrings("Bcc", bcc)
+}
+
+// SetReplyTo creates the Reply-To header with the specified
+// replyTo addresses.
+// It returns an error if any of the addresses is not
+// a valid RFC 5322 address.
+func (b *EmailBuilder) SetReplyTo(replyTo []string) error {
+	return b.setAddressStrings("Reply-To", replyTo)
+}
+
+// SetAddresses creates the key header with the specified addresses.
+// The display names will be quoted if necessary.
+// If addrs is empty the key header will be deleted.
+// It returns an error if any of the addresses is invalid.
+func (b *EmailBuilder) SetAddresses(key string, addrs ...*mail.Address) error {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		s, err := formatAddress(a)
+		if err != nil {
+			return fmt.Errorf("invalid %s address: %w", key, err)
+		}
+		parts[i] = s
+	}
+
+	if len(parts) == 0 {
+		b.Headers.Del(key)
+		return nil
+	}
+	b.Headers.Set(key, strings.Join(parts, ", "))
+	return nil
+}
+
+// setAddressStrings parses the addresses in list
+// and creates the key header from them.
+func (b *EmailBuilder) setAddressStrings(key string, list []string) error {
+	addrs := make([]*mail.Address, len(list))
+	for i, s := range list {
+		a, err := mail.ParseAddress(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s address %q: %w", key, s, err)
+		}
+		addrs[i] = a
+	}
+	return b.SetAddresses(key, addrs...)
+}
+
+// formatAddress validates the a address and formats it
+// as an RFC 5322 name-addr or addr-spec.
+// Non-ASCII display names are left unencoded,
+// they will be encoded by the Write method.
+func formatAddress(a *mail.Address) (string, error) {
+	if a == nil {
+		return "", fmt.Errorf("nil address")
+	}
+
+	// ParseAddress validates the addr-spec and rejects
+	// anything after it.
+	spec := formatAddrSpec(a.Address)
+	_, err := mail.ParseAddress("<" + spec + ">")
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", a.Address, err)
+	}
+
+	if strings.ContainsAny(a.Name, "\r\n") {
+		return "", fmt.Errorf("line break in display name %q", a.Name)
+	}
+
+	if a.Name == "" {
+		return spec, nil
+	}
+	return quotePhrase(a.Name) + " <" + spec + ">", nil
+}
+
+// formatAddrSpec formats the addr address as an RFC 5322 addr-spec
+// quoting the local-part if necessary.
+func formatAddrSpec(addr string) string {
+	s := (&mail.Address{Address: addr}).String()
+	return strings.TrimSuffix(strings.TrimPrefix(s, "<"), ">")
+}
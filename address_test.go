@@ -0,0 +1,156 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailBuilderAddressSetters(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Key         string
+		Set         func(b *email.EmailBuilder) error
+		Expected    string
+		ExpectedErr string
+	}{
+		{
+			Name: "from",
+			Key:  "From",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetFrom(`"Google Alerts" <googlealerts-noreply@example.com>`)
+			},
+			Expected: "Google Alerts <googlealerts-noreply@example.com>",
+		},
+		{
+			Name: "sender",
+			Key:  "Sender",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetSender("bounces@example.com")
+			},
+			Expected: "bounces@example.com",
+		},
+		{
+			Name: "to",
+			Key:  "To",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetTo([]string{"alice@example.com", "Bob <bob@example.com>"})
+			},
+			Expected: "alice@example.com, Bob <bob@example.com>",
+		},
+		{
+			Name: "cc with special characters",
+			Key:  "Cc",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetCc([]string{`"Doe, John" <john@example.com>`, `"Say \"Hi\"" <hi@example.com>`})
+			},
+			Expected: `"Doe, John" <john@example.com>, "Say \"Hi\"" <hi@example.com>`,
+		},
+		{
+			Name: "bcc",
+			Key:  "Bcc",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetBcc([]string{"archive@example.com"})
+			},
+			Expected: "archive@example.com",
+		},
+		{
+			Name: "reply-to with non-ASCII name",
+			Key:  "Reply-To",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetReplyTo([]string{"Szakszon Péter <peter@example.com>"})
+			},
+			Expected: "Szakszon Péter <peter@example.com>",
+		},
+		{
+			Name: "addresses",
+			Key:  "To",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetAddresses("To",
+					&mail.Address{Name: "Alice", Address: "alice@example.com"},
+					&mail.Address{Name: "J. R. R. Tolkien", Address: "john doe@example.com"},
+				)
+			},
+			Expected: `Alice <alice@example.com>, "J. R. R. Tolkien" <"john doe"@example.com>`,
+		},
+		{
+			Name: "invalid from",
+			Key:  "From",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetFrom("hello")
+			},
+			ExpectedErr: `invalid From address "hello"`,
+		},
+		{
+			Name: "address list in from",
+			Key:  "From",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetFrom("alice@example.com, bob@example.com")
+			},
+			ExpectedErr: `invalid From address`,
+		},
+		{
+			Name: "invalid to",
+			Key:  "To",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetTo([]string{"alice@example.com", "Bob <bob@>"})
+			},
+			ExpectedErr: `invalid To address "Bob <bob@>"`,
+		},
+		{
+			Name: "invalid address",
+			Key:  "Cc",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetAddresses("Cc", &mail.Address{Address: "alice@"})
+			},
+			ExpectedErr: `invalid Cc address`,
+		},
+		{
+			Name: "line break in name",
+			Key:  "Cc",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetAddresses("Cc", &mail.Address{Name: "Alice\r\nBcc: x@example.com", Address: "alice@example.com"})
+			},
+			ExpectedErr: `invalid Cc address`,
+		},
+		{
+			Name: "nil address",
+			Key:  "Cc",
+			Set: func(b *email.EmailBuilder) error {
+				return b.SetAddresses("Cc", nil)
+			},
+			ExpectedErr: `invalid Cc address`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			err := c.Set(b)
+			if c.ExpectedErr != "" {
+				assert.ErrorContains(t, err, c.ExpectedErr)
+				assert.Empty(t, b.Headers.Get(c.Key))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, b.Headers.Get(c.Key))
+
+			list, err := mail.ParseAddressList(b.Headers.Get(c.Key))
+			assert.NoError(t, err)
+			assert.NotEmpty(t, list)
+		})
+	}
+}
+
+func TestEmailBuilderSetAddressesEmpty(t *testing.T) {
+	b := email.NewEmailBuilder()
+	err := b.SetCc([]string{"alice@example.com"})
+	assert.NoError(t, err)
+
+	err = b.SetCc(nil)
+	assert.NoError(t, err)
+	assert.False(t, b.Headers.Has("Cc"))
+}
@@ -0,0 +1,218 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a file attached to the email message
+// or a resource embedded in the HTML body.
+type Attachment struct {
+	// Headers stores the custom key-value pairs for the attachment part.
+	Headers Header
+
+	// Data is the encoded attachment content in wire format without the trailing \r\n.
+	Data bytes.Buffer
+
+	// Reader supplies the unencoded attachment content.
+	// If set, it is used instead of Data and encoded on the fly
+	// when the email is written.
+	Reader io.Reader
+}
+
+// Attach adds an attachment with the specified filename and data content.
+// The Content-Type of the attachment is guessed from the extension
+// of the filename and defaults to application/octet-stream.
+func (b *EmailBuilder) Attach(filename string, data []byte) *Attachment {
+	a := newAttachment("attachment", filename, data)
+	b.Attachments = append(b.Attachments, a)
+	return a
+}
+
+// AttachReader adds an attachment with the specified filename
+// and the content read from r until EOF.
+func (b *EmailBuilder) AttachReader(filename string, r io.Reader) (*Attachment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return b.Attach(filename, data), nil
+}
+
+// AttachStream adds an attachment with the specified filename
+// and the content read from r when the email is written.
+// The content is encoded using base64 encoding on the fly,
+// so it is never held in memory.
+func (b *EmailBuilder) AttachStream(filename string, r io.Reader) *Attachment {
+	a := newAttachment("attachment", filename, nil)
+	a.Reader = r
+	b.Attachments = append(b.Attachments, a)
+	return a
+}
+
+// AttachFile adds the file at the specified path as an attachment.
+// The filename of the attachment will be the last element of the path.
+func (b *EmailBuilder) AttachFile(path string) (*Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Attach(filepath.Base(path), data), nil
+}
+
+// AttachMessage adds the email m as a message/rfc822 attachment,
+// e.g. for forwarding or abuse reports.
+// The embedded message is m as rendered by Write without the DKIM
+// signatures, not the original bytes of a received message,
+// use AttachRawMessage for those. A copy of m is written,
+// so m is not modified, e.g. no Message-ID is stored in it.
+// It returns an error if m has streamed content,
+// which can be written only once.
+// The filename of the attachment is the subject of m
+// with the .eml extension.
+func (b *EmailBuilder) AttachMessage(m *EmailBuilder) (*Attachment, error) {
+	if m.hasStream() {
+		return nil, fmt.Errorf("email with streamed content can not be attached")
+	}
+	c := m.clone()
+	c.DKIMSigners = nil
+	msg := &bytes.Buffer{}
+	err := c.Write(msg)
+	if err != nil {
+		return nil, err
+	}
+	return b.AttachRawMessage(messageFilename(m.Headers.Get("Subject")), msg.Bytes()), nil
+}
+
+// AttachRawMessage adds the message in wire format as a message/rfc822
+// attachment with the specified filename.
+// The message is written without re-encoding, but its bare \n
+// line breaks are converted to \r\n as required in wire format.
+// The Content-Transfer-Encoding is 7bit, 8bit or binary
+// depending on the content of the message.
+func (b *EmailBuilder) AttachRawMessage(filename string, msg []byte) *Attachment {
+	a := newMessageAttachment(filename, msg)
+	b.Attachments = append(b.Attachments, a)
+	return a
+}
+
+// Embed adds an inline resource with the specified Content-ID,
+// filename and data content. The HTML body can reference the resource
+// with a cid: URL, e.g. <img src="cid:logo"> for the "logo" contentID.
+// The Content-Type of the resource is guessed from the extension
+// of the filename and defaults to application/octet-stream.
+func (b *EmailBuilder) Embed(contentID, filename string, data []byte) *Attachment {
+	a := newAttachment("inline", filename, data)
+	a.Headers.Set("Content-ID", "<"+contentID+">")
+	b.Inlines = append(b.Inlines, a)
+	return a
+}
+
+// EmbedReader adds an inline resource with the specified Content-ID,
+// filename and the content read from r until EOF.
+func (b *EmailBuilder) EmbedReader(contentID, filename string, r io.Reader) (*Attachment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return b.Embed(contentID, filename, data), nil
+}
+
+// EmbedStream adds an inline resource with the specified Content-ID,
+// filename and the content read from r when the email is written.
+// The content is encoded using base64 encoding on the fly,
+// so it is never held in memory.
+func (b *EmailBuilder) EmbedStream(contentID, filename string, r io.Reader) *Attachment {
+	a := newAttachment("inline", filename, nil)
+	a.Headers.Set("Content-ID", "<"+contentID+">")
+	a.Reader = r
+	b.Inlines = append(b.Inlines, a)
+	return a
+}
+
+// EmbedFile adds the file at the specified path as an inline resource
+// with the specified Content-ID.
+// The filename of the resource will be the last element of the path.
+func (b *EmailBuilder) EmbedFile(contentID, path string) (*Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.Embed(contentID, filepath.Base(path), data), nil
+}
+
+// newAttachment creates a base64 encoded attachment
+// with the specified disposition type.
+// The encoded lines are wrapped at 76 characters.
+func newAttachment(disposition, filename string, data []byte) *Attachment {
+	a := &Attachment{}
+
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	a.Headers.Set("Content-Type", contentType)
+	a.Headers.Set("Content-Disposition", mime.FormatMediaType(
+		disposition,
+		map[string]string{"filename": filename},
+	))
+	a.Headers.Set("Content-Transfer-Encoding", "base64")
+
+	encoder := newBase64Encoder(&a.Data)
+	encoder.Write(data)
+	encoder.Close()
+	return a
+}
+
+// newMessageAttachment creates a message/rfc822 attachment containing
+// the message in wire format. The message is not re-encoded,
+// only its bare \n line breaks are converted to \r\n.
+// Its trailing \r\n is kept in Data, because it belongs to the
+// message, not to the delimiter following the attachment.
+func newMessageAttachment(filename string, msg []byte) *Attachment {
+	a := &Attachment{}
+	msg = normalizeNewlines(msg)
+	a.Headers.Set("Content-Type", "message/rfc822")
+	a.Headers.Set("Content-Disposition", mime.FormatMediaType(
+		"attachment",
+		map[string]string{"filename": filename},
+	))
+	a.Headers.Set("Content-Transfer-Encoding", messageTransferEncoding(msg))
+	a.Data.Write(msg)
+	return a
+}
+
+// messageTransferEncoding returns the Content-Transfer-Encoding
+// of an embedded message: only 7bit, 8bit and binary are allowed
+// for message/rfc822 parts (RFC 2046 section 5.2.1).
+func messageTransferEncoding(msg []byte) string {
+	if TransferEncoding(msg) == "7bit" {
+		return "7bit"
+	}
+	for _, line := range bytes.Split(msg, []byte("\r\n")) {
+		if len(line) > maxLineLength || bytes.ContainsAny(line, "\x00\r\n") {
+			return "binary"
+		}
+	}
+	return "8bit"
+}
+
+// messageFilename returns the filename of an embedded message
+// with the specified subject.
+func messageFilename(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(subject))
+	if subject == "" {
+		subject = "message"
+	}
+	return subject + ".eml"
+}
@@ -0,0 +1,348 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailBuilderAttachments(t *testing.T) {
+	cases := []struct {
+		Name      string
+		PlainText string
+		HTMLText  string
+
+		ExpectedBodyTypes []string
+	}{
+		{
+			Name:              "attachments only",
+			ExpectedBodyTypes: nil,
+		},
+		{
+			Name:              "text and attachments",
+			PlainText:         "plain text message",
+			ExpectedBodyTypes: []string{"text/plain"},
+		},
+		{
+			Name:              "html and attachments",
+			HTMLText:          "<p>HTML message</p>",
+			ExpectedBodyTypes: []string{"text/html"},
+		},
+		{
+			Name:              "text, html and attachments",
+			PlainText:         "plain text message",
+			HTMLText:          "<p>HTML message</p>",
+			ExpectedBodyTypes: []string{"multipart/alternative"},
+		},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	err := os.WriteFile(path, []byte("a,b\r\n1,2\r\n"), 0600)
+	assert.NoError(t, err)
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.SetFrom("hello@example.com")
+			b.SetTo([]string{"alice@example.com"})
+			b.SetSubject("Invoice")
+			b.Boundary = "abc123"
+
+			if c.PlainText != "" {
+				b.EncodeQuotedPlain([]byte(c.PlainText))
+			}
+			if c.HTMLText != "" {
+				b.EncodeQuotedHTML([]byte(c.HTMLText))
+			}
+
+			b.Attach("invoice.pdf", []byte("%PDF-1.4 invoice"))
+			_, err := b.AttachReader("számla.bin", strings.NewReader("\x00\x01\x02"))
+			assert.NoError(t, err)
+			_, err = b.AttachFile(path)
+			assert.NoError(t, err)
+
+			w := &bytes.Buffer{}
+			err = b.Write(w)
+			assert.NoError(t, err)
+
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			assert.NoError(t, err)
+			assert.Equal(t, "multipart/mixed", mediaType)
+			assert.Equal(t, "abc123", params["boundary"])
+
+			var types []string
+			var filenames []string
+			var contents []string
+			r := multipart.NewReader(msg.Body, params["boundary"])
+			for {
+				p, err := r.NextPart()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+
+				if p.FileName() == "" {
+					mediaType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+					assert.NoError(t, err)
+					types = append(types, mediaType)
+					continue
+				}
+
+				disposition, _, err := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+				assert.NoError(t, err)
+				assert.Equal(t, "attachment", disposition)
+				assert.Equal(t, "base64", p.Header.Get("Content-Transfer-Encoding"))
+
+				data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+				assert.NoError(t, err)
+				filenames = append(filenames, p.FileName())
+				contents = append(contents, string(data))
+			}
+
+			assert.Equal(t, c.ExpectedBodyTypes, types)
+			assert.Equal(t, []string{"invoice.pdf", "számla.bin", "report.csv"}, filenames)
+			assert.Equal(t, []string{"%PDF-1.4 invoice", "\x00\x01\x02", "a,b\r\n1,2\r\n"}, contents)
+		})
+	}
+}
+
+func TestEmailBuilderAttachmentContentType(t *testing.T) {
+	b := email.NewEmailBuilder()
+	pdf := b.Attach("invoice.pdf", nil)
+	unknown := b.Attach("data.unknownext", nil)
+
+	assert.Equal(t, "application/pdf", pdf.Headers.Get("Content-Type"))
+	assert.Equal(t, "application/octet-stream", unknown.Headers.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=invoice.pdf`, pdf.Headers.Get("Content-Disposition"))
+}
+
+func TestEmailBuilderAttachFileNotFound(t *testing.T) {
+	b := email.NewEmailBuilder()
+	_, err := b.AttachFile(filepath.Join(t.TempDir(), "missing.pdf"))
+	assert.Error(t, err)
+	assert.Empty(t, b.Attachments)
+}
+
+func TestEmailBuilderInlines(t *testing.T) {
+	cases := []struct {
+		Name       string
+		PlainText  string
+		Attachment bool
+		Expected   string
+	}{
+		{
+			Name:     "html and inline",
+			Expected: "multipart/related(text/html,image/png)",
+		},
+		{
+			Name:      "text, html and inline",
+			PlainText: "plain text message",
+			Expected:  "multipart/alternative(text/plain,multipart/related(text/html,image/png))",
+		},
+		{
+			Name:       "html, inline and attachment",
+			Attachment: true,
+			Expected:   "multipart/mixed(multipart/related(text/html,image/png),application/pdf)",
+		},
+		{
+			Name:       "text, html, inline and attachment",
+			PlainText:  "plain text message",
+			Attachment: true,
+			Expected:   "multipart/mixed(multipart/alternative(text/plain,multipart/related(text/html,image/png)),application/pdf)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.SetFrom("hello@example.com")
+			b.SetTo([]string{"alice@example.com"})
+			b.SetSubject("Newsletter")
+
+			if c.PlainText != "" {
+				b.EncodeQuotedPlain([]byte(c.PlainText))
+			}
+			b.EncodeQuotedHTML([]byte(`<img src="cid:logo">`))
+			b.Embed("logo", "logo.png", []byte("\x89PNG"))
+			if c.Attachment {
+				b.Attach("invoice.pdf", []byte("%PDF-1.4"))
+			}
+
+			w := &bytes.Buffer{}
+			err := b.Write(w)
+			assert.NoError(t, err)
+
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body))
+		})
+	}
+}
+
+func TestEmailBuilderInlineHeaders(t *testing.T) {
+	b := email.NewEmailBuilder()
+	a := b.Embed("logo@example.com", "logo.png", nil)
+
+	assert.Equal(t, "<logo@example.com>", a.Headers.Get("Content-ID"))
+	assert.Equal(t, "image/png", a.Headers.Get("Content-Type"))
+	assert.Equal(t, "inline; filename=logo.png", a.Headers.Get("Content-Disposition"))
+}
+
+func TestEmailBuilderInlinesWithoutHTML(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.EncodeQuotedPlain([]byte("plain text message"))
+	b.Embed("logo", "logo.png", []byte("\x89PNG"))
+
+	err := b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+// mimeStructure returns the content types of a MIME entity and its
+// nested parts in a compact form, e.g. multipart/mixed(text/plain,image/png).
+func mimeStructure(t *testing.T, contentType string, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	assert.NoError(t, err)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return mediaType
+	}
+
+	var children []string
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		children = append(children, mimeStructure(t, p.Header.Get("Content-Type"), p))
+	}
+	return mediaType + "(" + strings.Join(children, ",") + ")"
+}
+
+func TestEmailBuilderAttachMessage(t *testing.T) {
+	inner := email.NewEmailBuilder()
+	err := inner.SetFrom("spammer@example.net")
+	assert.NoError(t, err)
+	inner.SetSubject("Cheap: pills?")
+	inner.Headers.Set("Message-ID", "<spam@example.net>")
+	inner.Headers.Set("Date", "Mon, 02 May 2022 19:51:17 +0200")
+	err = inner.EncodeBase64Plain([]byte("Buy now"))
+	assert.NoError(t, err)
+	inner.Attach("offer.pdf", []byte("%PDF-1.4"))
+	raw := &bytes.Buffer{}
+	err = inner.Write(raw)
+	assert.NoError(t, err)
+
+	b := email.NewEmailBuilder()
+	b.SetPlainBody([]byte("Abuse report"))
+	a, err := b.AttachMessage(inner)
+	assert.NoError(t, err)
+	assert.Equal(t, "message/rfc822", a.Headers.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="Cheap_ pills_.eml"`, a.Headers.Get("Content-Disposition"))
+	assert.Equal(t, "7bit", a.Headers.Get("Content-Transfer-Encoding"))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/mixed(text/plain,message/rfc822)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	attached := parsed.Body.Parts[1]
+	assert.Equal(t, raw.String(), string(attached.Body))
+
+	reparsed, err := email.Parse(bytes.NewReader(attached.Body))
+	assert.NoError(t, err)
+	assert.Equal(t, "<spam@example.net>", reparsed.MessageID())
+	assert.Equal(t, "Cheap: pills?", reparsed.Headers.Get("Subject"))
+}
+
+func TestEmailBuilderAttachMessageCopy(t *testing.T) {
+	inner := email.NewEmailBuilder()
+	inner.SetSubject("Hello")
+	err := inner.SetPlainBody([]byte("Hello"))
+	assert.NoError(t, err)
+
+	b := email.NewEmailBuilder()
+	_, err = b.AttachMessage(inner)
+	assert.NoError(t, err)
+	assert.Equal(t, "", inner.MessageID(), "the attached email must not be modified")
+
+	err = inner.StreamBase64Plain(strings.NewReader("Hello"))
+	assert.NoError(t, err)
+	_, err = b.AttachMessage(inner)
+	assert.Error(t, err)
+}
+
+func TestEmailBuilderAttachRawMessage(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Message  string
+		Encoding string
+		Expected string
+	}{
+		{
+			Name:     "7bit",
+			Message:  "Subject: Hi\n\nHello\n",
+			Encoding: "7bit",
+			Expected: "Subject: Hi\r\n\r\nHello\r\n",
+		},
+		{
+			Name:     "8bit",
+			Message:  "Subject: Hi\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\nHélló\r\n",
+			Encoding: "8bit",
+			Expected: "Subject: Hi\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\nHélló\r\n",
+		},
+		{
+			Name:     "binary",
+			Message:  "Subject: Hi\r\n\r\n" + strings.Repeat("x", 1000),
+			Encoding: "binary",
+			Expected: "Subject: Hi\r\n\r\n" + strings.Repeat("x", 1000),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			a := b.AttachRawMessage("report.eml", []byte(c.Message))
+			assert.Equal(t, c.Encoding, a.Headers.Get("Content-Transfer-Encoding"))
+
+			w := &bytes.Buffer{}
+			err := b.Write(w)
+			assert.NoError(t, err)
+			parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, string(parsed.Body.Parts[0].Body))
+		})
+	}
+}
+
+func TestEmailBuilderAttachRawMessageBoundary(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Boundary = "frontier"
+	b.AttachRawMessage("report.eml", []byte("Content-Type: multipart/mixed; boundary=frontier\r\n\r\n--frontier\r\n\r\nHello\r\n--frontier--"))
+	err := b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,397 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iTIP methods of calendar invitations (RFC 5546 section 1.4).
+const (
+	CalendarRequest = "REQUEST"
+	CalendarCancel  = "CANCEL"
+	CalendarReply   = "REPLY"
+)
+
+// Participation statuses of the attendees (RFC 5545 section 3.2.12).
+const (
+	PartStatNeedsAction = "NEEDS-ACTION"
+	PartStatAccepted    = "ACCEPTED"
+	PartStatDeclined    = "DECLINED"
+	PartStatTentative   = "TENTATIVE"
+)
+
+// maxCalendarLineLength is the maximum length of the
+// iCalendar content lines in octets without the \r\n.
+const maxCalendarLineLength = 75
+
+// Event is an iCalendar event (RFC 5545) of a calendar invitation.
+type Event struct {
+	// UID is the globally unique identifier of the event.
+	// The updates and the replies must have the same UID.
+	UID string
+
+	// Sequence is the revision of the event.
+	// It must be incremented when the event is updated or cancelled.
+	Sequence int
+
+	// Stamp is the creation time of the invitation.
+	// It defaults to the current time.
+	Stamp time.Time
+
+	// Start and End are the start and the end of the event.
+	// The times are written in the time zone of Start
+	// with the VTIMEZONE component describing it
+	// unless it is UTC, the local time zone or a zone without
+	// an IANA name, e.g. a fixed offset parsed from an RFC 3339 time,
+	// which are written as UTC times.
+	Start time.Time
+	End   time.Time
+
+	// AllDay reports whether only the dates of Start and End
+	// are written without a time zone.
+	// End is the day after the last day of the event.
+	AllDay bool
+
+	Summary     string
+	Description string
+	Location    string
+
+	// Status is the status of the event, e.g. CONFIRMED, TENTATIVE
+	// or CANCELLED. It defaults to CANCELLED in cancellations
+	// and CONFIRMED otherwise.
+	Status string
+
+	// Organizer is the organizer of the event.
+	// It is required in requests and cancellations.
+	Organizer mail.Address
+
+	// Attendees are the attendees of the event.
+	// A reply contains only the replying attendee.
+	Attendees []*Attendee
+}
+
+// Attendee is an attendee of an event.
+type Attendee struct {
+	mail.Address
+
+	// Role is the participation role, e.g. REQ-PARTICIPANT
+	// or OPT-PARTICIPANT. It defaults to REQ-PARTICIPANT.
+	Role string
+
+	// Status is the participation status.
+	// It defaults to PartStatNeedsAction.
+	Status string
+
+	// RSVP reports whether a reply is expected from the attendee.
+	RSVP bool
+}
+
+// Calendar returns the iCalendar object of the event
+// with the specified iTIP method.
+// It returns an error if the method is not supported
+// or the required properties are missing.
+func (e *Event) Calendar(method string) ([]byte, error) {
+	switch method {
+	case CalendarRequest, CalendarCancel, CalendarReply:
+	default:
+		return nil, fmt.Errorf("unsupported calendar method: %s", method)
+	}
+	if e.UID == "" {
+		return nil, fmt.Errorf("missing event UID")
+	}
+	if e.Start.IsZero() || e.End.IsZero() {
+		return nil, fmt.Errorf("missing event start or end")
+	}
+	if !e.End.After(e.Start) {
+		return nil, fmt.Errorf("event ends before it starts")
+	}
+	if e.Organizer.Address == "" && method != CalendarReply {
+		return nil, fmt.Errorf("missing event organizer")
+	}
+	if len(e.Attendees) == 0 && method == CalendarReply {
+		return nil, fmt.Errorf("missing replying attendee")
+	}
+
+	start, end := e.Start, e.End
+	loc := start.Location()
+	switch {
+	case e.AllDay:
+		loc = time.UTC
+	case loc == time.Local || !isZoneName(loc.String()):
+		// The local and the fixed zones have no usable TZID.
+		loc = time.UTC
+		start, end = start.UTC(), end.UTC()
+	default:
+		end = end.In(loc)
+	}
+
+	w := &calendarWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("PRODID:-//szxp//email//EN")
+	w.line("VERSION:2.0")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:" + method)
+	if loc != time.UTC {
+		w.timezone(loc, e.Start.Year())
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + escapeCalendarText(e.UID))
+	stamp := e.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	w.line("DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"))
+	w.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+	w.time("DTSTART", start, e.AllDay)
+	w.time("DTEND", end, e.AllDay)
+	if e.Summary != "" {
+		w.line("SUMMARY:" + escapeCalendarText(e.Summary))
+	}
+	if e.Description != "" {
+		w.line("DESCRIPTION:" + escapeCalendarText(e.Description))
+	}
+	if e.Location != "" {
+		w.line("LOCATION:" + escapeCalendarText(e.Location))
+	}
+
+	status := e.Status
+	if status == "" {
+		status = "CONFIRMED"
+		if method == CalendarCancel {
+			status = "CANCELLED"
+		}
+	}
+	w.line("STATUS:" + status)
+
+	if e.Organizer.Address != "" {
+		w.line("ORGANIZER" + calendarName(e.Organizer.Name) + ":mailto:" + e.Organizer.Address)
+	}
+	for _, a := range e.Attendees {
+		role := a.Role
+		if role == "" {
+			role = "REQ-PARTICIPANT"
+		}
+		partStat := a.Status
+		if partStat == "" {
+			partStat = PartStatNeedsAction
+		}
+		params := calendarName(a.Name) + ";ROLE=" + role + ";PARTSTAT=" + partStat
+		if a.RSVP {
+			params += ";RSVP=TRUE"
+		}
+		w.line("ATTENDEE" + params + ":mailto:" + a.Address.Address)
+	}
+	w.line("END:VEVENT")
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes(), nil
+}
+
+// AttachEvent adds the iCalendar object of the event with the
+// specified iTIP method as a text/calendar alternative of the body
+// and as an invite.ics attachment, so the mail clients show
+// the invitation with the buttons to reply.
+func (b *EmailBuilder) AttachEvent(method string, e *Event) error {
+	data, err := e.Calendar(method)
+	if err != nil {
+		return err
+	}
+
+	calendar := NewPart("text/calendar; charset=utf-8; method=" + method)
+	// The last line break is written by the part.
+	body := &bytes.Buffer{}
+	err = encodeBody(body, &calendar.Headers, bytes.TrimSuffix(data, []byte("\r\n")))
+	if err != nil {
+		return err
+	}
+	calendar.Body = body.Bytes()
+	b.Calendar = calendar
+
+	a := b.Attach("invite.ics", data)
+	a.Headers.Set("Content-Type", `application/ics; name="invite.ics"`)
+	return nil
+}
+
+// calendarWriter writes iCalendar content lines
+// folded at 75 octets.
+type calendarWriter struct {
+	buf bytes.Buffer
+}
+
+// line writes the content line s folded at 75 octets
+// without splitting UTF-8 encoded characters.
+func (w *calendarWriter) line(s string) {
+	limit := maxCalendarLineLength
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		w.buf.WriteString(s[:i])
+		w.buf.WriteString("\r\n ")
+		s = s[i:]
+		// The continuation lines start with a space.
+		limit = maxCalendarLineLength - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+// time writes the date-time property of t in its time zone.
+func (w *calendarWriter) time(name string, t time.Time, date bool) {
+	switch {
+	case date:
+		w.line(name + ";VALUE=DATE:" + t.Format("20060102"))
+	case t.Location() == time.UTC:
+		w.line(name + ":" + t.Format("20060102T150405Z"))
+	default:
+		w.line(name + ";TZID=" + t.Location().String() + ":" + t.Format("20060102T150405"))
+	}
+}
+
+// timezone writes the VTIMEZONE component of loc with the
+// observances and their yearly rules found in the specified year.
+func (w *calendarWriter) timezone(loc *time.Location, year int) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	transitions := zoneTransitions(loc, year)
+	if len(transitions) == 0 {
+		t := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		name, offset := t.Zone()
+		w.line("BEGIN:STANDARD")
+		w.line("DTSTART:19700101T000000")
+		w.line("TZOFFSETFROM:" + formatUTCOffset(offset))
+		w.line("TZOFFSETTO:" + formatUTCOffset(offset))
+		w.line("TZNAME:" + name)
+		w.line("END:STANDARD")
+	}
+	for _, t := range transitions {
+		before := t.Add(-time.Second)
+		_, from := before.Zone()
+		name, to := t.Zone()
+		observance := "STANDARD"
+		if t.IsDST() {
+			observance = "DAYLIGHT"
+		}
+		// The onset is the local time before the transition.
+		// The observance starts in 1970 on the day of the rule,
+		// so it covers the whole year of the event.
+		onset := t.In(time.FixedZone("", from))
+		week, weekday := ruleDay(onset)
+		first := ruleDate(1970, onset.Month(), week, weekday)
+		w.line("BEGIN:" + observance)
+		w.line("DTSTART:" + first.Format("20060102") + onset.Format("T150405"))
+		w.line("TZOFFSETFROM:" + formatUTCOffset(from))
+		w.line("TZOFFSETTO:" + formatUTCOffset(to))
+		w.line("TZNAME:" + name)
+		w.line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", onset.Month(), week, weekdayNames[weekday]))
+		w.line("END:" + observance)
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// zoneTransitions returns the times of the UTC offset changes
+// of loc in the specified year.
+func zoneTransitions(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	t := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	end := t.AddDate(1, 0, 0)
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		_, offset := t.Zone()
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			// Binary search for the first second with the new offset.
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			transitions = append(transitions, hi)
+		}
+		t = next
+	}
+	return transitions
+}
+
+// weekdayNames are the iCalendar names of the weekdays.
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ruleDay returns the week of the month and the weekday of t
+// in a yearly rule, e.g. -1 and Sunday for the last Sunday of March.
+func ruleDay(t time.Time) (int, time.Weekday) {
+	lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	week := (t.Day()-1)/7 + 1
+	if t.Day()+7 > lastDay {
+		week = -1
+	}
+	return week, t.Weekday()
+}
+
+// ruleDate returns the date of the weekday in the specified week
+// of the month. The week -1 is the last week of the month.
+func ruleDate(year int, month time.Month, week int, weekday time.Weekday) time.Time {
+	if week == -1 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -int(last.Weekday()-weekday+7)%7)
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return first.AddDate(0, 0, int(weekday-first.Weekday()+7)%7+(week-1)*7)
+}
+
+// isZoneName reports whether name is the name of a time zone
+// in the IANA Time Zone database.
+func isZoneName(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// formatUTCOffset formats the UTC offset in seconds as +hhmm.
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
+
+// calendarName returns the CN parameter of the name.
+// The name is quoted if it contains a separator character.
+func calendarName(name string) string {
+	if name == "" {
+		return ""
+	}
+	name = strings.NewReplacer(`"`, "", "\r", "", "\n", " ").Replace(name)
+	if strings.ContainsAny(name, ",;:") {
+		name = `"` + name + `"`
+	}
+	return ";CN=" + name
+}
+
+// escapeCalendarText escapes the TEXT value (RFC 5545 section 3.3.11).
+func escapeCalendarText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
@@ -0,0 +1,294 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEvent(start time.Time) *email.Event {
+	return &email.Event{
+		UID:         "20261020-standup@example.com",
+		Stamp:       time.Date(2026, time.October, 1, 8, 0, 0, 0, time.UTC),
+		Start:       start,
+		End:         start.Add(30 * time.Minute),
+		Summary:     "Standup",
+		Description: "Agenda:\n1. Status, plans; blockers",
+		Location:    "Room 2",
+		Organizer:   mail.Address{Name: "Alice", Address: "alice@example.com"},
+		Attendees: []*email.Attendee{
+			{Address: mail.Address{Name: "Bob, Jr.", Address: "bob@example.com"}, RSVP: true},
+			{Address: mail.Address{Address: "carol@example.com"}, Role: "OPT-PARTICIPANT"},
+		},
+	}
+}
+
+// unfoldCalendar returns the unfolded content lines.
+func unfoldCalendar(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestEventCalendar(t *testing.T) {
+	start := time.Date(2026, time.October, 20, 10, 0, 0, 0, time.UTC)
+	data, err := newTestEvent(start).Calendar(email.CalendarRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//szxp//email//EN",
+		"VERSION:2.0",
+		"CALSCALE:GREGORIAN",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		"UID:20261020-standup@example.com",
+		"DTSTAMP:20261001T080000Z",
+		"SEQUENCE:0",
+		"DTSTART:20261020T100000Z",
+		"DTEND:20261020T103000Z",
+		"SUMMARY:Standup",
+		`DESCRIPTION:Agenda:\n1. Status\, plans\; blockers`,
+		"LOCATION:Room 2",
+		"STATUS:CONFIRMED",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com",
+		`ATTENDEE;CN="Bob, Jr.";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.com`,
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:carol@example.com",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, unfoldCalendar(data))
+
+	for _, line := range strings.Split(string(data), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	data, err = newTestEvent(start).Calendar(email.CalendarCancel)
+	assert.NoError(t, err)
+	assert.Contains(t, unfoldCalendar(data), "METHOD:CANCEL")
+	assert.Contains(t, unfoldCalendar(data), "STATUS:CANCELLED")
+
+	e := newTestEvent(start)
+	e.AllDay = true
+	e.End = start.AddDate(0, 0, 1)
+	data, err = e.Calendar(email.CalendarRequest)
+	assert.NoError(t, err)
+	assert.Contains(t, unfoldCalendar(data), "DTSTART;VALUE=DATE:20261020")
+	assert.Contains(t, unfoldCalendar(data), "DTEND;VALUE=DATE:20261021")
+}
+
+func TestEventCalendarTimezone(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Location string
+		Expected []string
+	}{
+		{
+			Name:     "europe",
+			Location: "Europe/Budapest",
+			Expected: []string{
+				"BEGIN:VTIMEZONE",
+				"TZID:Europe/Budapest",
+				"BEGIN:DAYLIGHT",
+				"DTSTART:19700329T020000",
+				"TZOFFSETFROM:+0100",
+				"TZOFFSETTO:+0200",
+				"TZNAME:CEST",
+				"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+				"END:DAYLIGHT",
+				"BEGIN:STANDARD",
+				"DTSTART:19701025T030000",
+				"TZOFFSETFROM:+0200",
+				"TZOFFSETTO:+0100",
+				"TZNAME:CET",
+				"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU",
+				"END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+		{
+			Name:     "america",
+			Location: "America/New_York",
+			Expected: []string{
+				"BEGIN:VTIMEZONE",
+				"TZID:America/New_York",
+				"BEGIN:DAYLIGHT",
+				"DTSTART:19700308T020000",
+				"TZOFFSETFROM:-0500",
+				"TZOFFSETTO:-0400",
+				"TZNAME:EDT",
+				"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU",
+				"END:DAYLIGHT",
+				"BEGIN:STANDARD",
+				"DTSTART:19701101T020000",
+				"TZOFFSETFROM:-0400",
+				"TZOFFSETTO:-0500",
+				"TZNAME:EST",
+				"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU",
+				"END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+		{
+			Name:     "southern hemisphere",
+			Location: "Australia/Sydney",
+			Expected: []string{
+				"BEGIN:VTIMEZONE",
+				"TZID:Australia/Sydney",
+				"BEGIN:STANDARD",
+				"DTSTART:19700405T030000",
+				"TZOFFSETFROM:+1100",
+				"TZOFFSETTO:+1000",
+				"TZNAME:AEST",
+				"RRULE:FREQ=YEARLY;BYMONTH=4;BYDAY=1SU",
+				"END:STANDARD",
+				"BEGIN:DAYLIGHT",
+				"DTSTART:19701004T020000",
+				"TZOFFSETFROM:+1000",
+				"TZOFFSETTO:+1100",
+				"TZNAME:AEDT",
+				"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=1SU",
+				"END:DAYLIGHT",
+				"END:VTIMEZONE",
+			},
+		},
+		{
+			Name:     "without daylight saving time",
+			Location: "Asia/Tokyo",
+			Expected: []string{
+				"BEGIN:VTIMEZONE",
+				"TZID:Asia/Tokyo",
+				"BEGIN:STANDARD",
+				"DTSTART:19700101T000000",
+				"TZOFFSETFROM:+0900",
+				"TZOFFSETTO:+0900",
+				"TZNAME:JST",
+				"END:STANDARD",
+				"END:VTIMEZONE",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			loc, err := time.LoadLocation(c.Location)
+			assert.NoError(t, err)
+
+			// The observances must cover the events before the first
+			// transition of the year too.
+			for _, month := range []time.Month{time.January, time.October} {
+				start := time.Date(2026, month, 20, 10, 0, 0, 0, loc)
+				data, err := newTestEvent(start).Calendar(email.CalendarRequest)
+				assert.NoError(t, err)
+				lines := unfoldCalendar(data)
+				assert.Equal(t, c.Expected, lines[5:5+len(c.Expected)])
+				assert.Contains(t, lines, "DTSTART;TZID="+c.Location+":"+start.Format("20060102")+"T100000")
+				assert.Contains(t, lines, "DTEND;TZID="+c.Location+":"+start.Format("20060102")+"T103000")
+			}
+		})
+	}
+}
+
+func TestEventCalendarFixedZone(t *testing.T) {
+	start, err := time.Parse(time.RFC3339, "2026-01-20T10:00:00+01:00")
+	assert.NoError(t, err)
+	for _, start := range []time.Time{start, start.In(time.FixedZone("CEST-ish", 3600))} {
+		data, err := newTestEvent(start).Calendar(email.CalendarRequest)
+		assert.NoError(t, err)
+		lines := unfoldCalendar(data)
+		assert.NotContains(t, lines, "BEGIN:VTIMEZONE")
+		assert.Contains(t, lines, "DTSTART:20260120T090000Z")
+		assert.Contains(t, lines, "DTEND:20260120T093000Z")
+	}
+}
+
+func TestEventCalendarFolding(t *testing.T) {
+	e := newTestEvent(time.Date(2026, time.October, 20, 10, 0, 0, 0, time.UTC))
+	e.Description = strings.Repeat("Megbeszélés ", 30)
+	data, err := e.Calendar(email.CalendarRequest)
+	assert.NoError(t, err)
+
+	for _, line := range strings.Split(string(data), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, strings.ToValidUTF8(line, "") == line, "line splits a character: %q", line)
+	}
+	assert.Contains(t, unfoldCalendar(data), "DESCRIPTION:"+e.Description)
+}
+
+func TestEventCalendarErrors(t *testing.T) {
+	start := time.Date(2026, time.October, 20, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		Name   string
+		Method string
+		Modify func(e *email.Event)
+	}{
+		{Name: "unsupported method", Method: "PUBLISH", Modify: func(e *email.Event) {}},
+		{Name: "missing UID", Method: email.CalendarRequest, Modify: func(e *email.Event) { e.UID = "" }},
+		{Name: "missing start", Method: email.CalendarRequest, Modify: func(e *email.Event) { e.Start = time.Time{} }},
+		{Name: "end before start", Method: email.CalendarRequest, Modify: func(e *email.Event) { e.End = e.Start.Add(-time.Hour) }},
+		{Name: "missing organizer", Method: email.CalendarCancel, Modify: func(e *email.Event) { e.Organizer = mail.Address{} }},
+		{Name: "missing attendee", Method: email.CalendarReply, Modify: func(e *email.Event) { e.Attendees = nil }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			e := newTestEvent(start)
+			c.Modify(e)
+			_, err := e.Calendar(c.Method)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEmailBuilderAttachEvent(t *testing.T) {
+	e := newTestEvent(time.Date(2026, time.October, 20, 10, 0, 0, 0, time.UTC))
+
+	b := email.NewEmailBuilder()
+	b.SetSubject("Invitation: Standup")
+	b.EncodeQuotedPlain([]byte("You are invited to the standup."))
+	b.EncodeQuotedHTML([]byte("<p>You are invited to the standup.</p>"))
+	err := b.AttachEvent(email.CalendarRequest, e)
+	assert.NoError(t, err)
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/mixed(multipart/alternative(text/plain,text/html,text/calendar),application/ics)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	calendar := parsed.Body.Parts[0].Parts[2]
+	_, params, err := mime.ParseMediaType(calendar.Headers.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "REQUEST", params["method"])
+	assert.Equal(t, "7bit", calendar.Headers.Get("Content-Transfer-Encoding"))
+
+	expected, err := e.Calendar(email.CalendarRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(calendar.Body)+"\r\n")
+
+	ics := parsed.Body.Parts[1]
+	assert.Equal(t, `attachment; filename=invite.ics`, ics.Headers.Get("Content-Disposition"))
+	content, err := ics.Content()
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(content))
+
+	// The invitation alone is the body.
+	b = email.NewEmailBuilder()
+	err = b.AttachEvent(email.CalendarCancel, e)
+	assert.NoError(t, err)
+	b.Attachments = nil
+	body, err := b.BodyPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "text/calendar; charset=utf-8; method=CANCEL", body.Headers.Get("Content-Type"))
+}
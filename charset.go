@@ -0,0 +1,135 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// encodeCharset converts the UTF-8 encoded s to the specified charset.
+// It returns an error if the charset is not supported
+// or s contains characters not representable in the charset.
+func encodeCharset(charset, s string) (string, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8":
+		if !utf8.ValidString(s) {
+			return "", fmt.Errorf("invalid UTF-8 text: %q", s)
+		}
+		return s, nil
+	case "us-ascii", "ascii":
+		if !isASCII(s) {
+			return "", fmt.Errorf("non-ASCII characters not representable in charset %s: %q", charset, s)
+		}
+		return s, nil
+	case "iso-8859-1", "latin1":
+		buf := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				return "", fmt.Errorf("character %q not representable in charset %s", r, charset)
+			}
+			buf = append(buf, byte(r))
+		}
+		return string(buf), nil
+	}
+
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("invalid UTF-8 text: %q", s)
+	}
+	e, err := enc.NewEncoder().String(s)
+	if err != nil {
+		for _, r := range s {
+			if _, err := enc.NewEncoder().String(string(r)); err != nil {
+				return "", fmt.Errorf("character %q not representable in charset %s", r, charset)
+			}
+		}
+		return "", err
+	}
+	return e, nil
+}
+
+// charsetEncoding returns the encoding of the charset
+// registered by IANA for use in MIME.
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	return enc, nil
+}
+
+// isStatefulCharset reports whether the encoding of the charset
+// switches between character sets with escape sequences,
+// e.g. ISO-2022-JP.
+func isStatefulCharset(charset string) bool {
+	return strings.HasPrefix(strings.ToLower(charset), "iso-2022-")
+}
+
+// bodyCharset returns the charset parameter of the Content-Type
+// header in headers. It returns an empty string if the body
+// is UTF-8 encoded or the charset is not specified.
+func bodyCharset(headers Header) string {
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	charset := params["charset"]
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8":
+		return ""
+	}
+	return charset
+}
+
+// encodeBodyCharset converts the UTF-8 encoded body s to the charset
+// of the Content-Type header in headers.
+func encodeBodyCharset(headers Header, s []byte) ([]byte, error) {
+	charset := bodyCharset(headers)
+	if charset == "" {
+		return s, nil
+	}
+	e, err := encodeCharset(charset, string(s))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(e), nil
+}
+
+// encodeBodyCharsetReader returns a reader converting the UTF-8 encoded
+// body read from r to the charset of the Content-Type header in headers.
+// The unrepresentable characters are reported by the reader.
+func encodeBodyCharsetReader(headers Header, r io.Reader) (io.Reader, error) {
+	charset := bodyCharset(headers)
+	if charset == "" {
+		return r, nil
+	}
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(r, enc.NewEncoder()), nil
+}
+
+// decodeCharsetReader returns a reader converting the text read
+// from input in the specified charset to UTF-8.
+// It is the CharsetReader of the encoded-word decoders.
+func decodeCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(input, enc.NewDecoder()), nil
+}
@@ -0,0 +1,114 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+func TestEmailBuilderBodyCharset(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Charset  string
+		Text     string
+		Encode   func(b *email.EmailBuilder, s string) error
+		Expected string
+
+		ExpectedEncoding string
+		ExpectedErr      bool
+	}{
+		{
+			Name:             "iso-8859-2 quoted-printable",
+			Charset:          "iso-8859-2",
+			Text:             "Zażółć gęślą jaźń",
+			Encode:           func(b *email.EmailBuilder, s string) error { return b.EncodeQuotedPlain([]byte(s)) },
+			Expected:         "Za=BF=F3=B3=E6 g=EA=B6l=B1 ja=BC=F1",
+			ExpectedEncoding: "quoted-printable",
+		},
+		{
+			Name:             "iso-8859-2 base64",
+			Charset:          "ISO-8859-2",
+			Text:             "Łódź",
+			Encode:           func(b *email.EmailBuilder, s string) error { return b.EncodeBase64Plain([]byte(s)) },
+			Expected:         "o/NkvA==",
+			ExpectedEncoding: "base64",
+		},
+		{
+			Name:             "iso-2022-jp",
+			Charset:          "iso-2022-jp",
+			Text:             "会議のお知らせ\r\n",
+			Encode:           func(b *email.EmailBuilder, s string) error { return b.SetPlainBody([]byte(s)) },
+			Expected:         "\x1b$B2q5D$N$*CN$i$;\x1b(B\r\n",
+			ExpectedEncoding: "7bit",
+		},
+		{
+			Name:             "stream",
+			Charset:          "iso-2022-jp",
+			Text:             "会議のお知らせ",
+			Encode:           func(b *email.EmailBuilder, s string) error { return b.StreamQuotedPlain(strings.NewReader(s)) },
+			Expected:         "=1B$B2q5D$N$*CN$i$;=1B(B",
+			ExpectedEncoding: "quoted-printable",
+		},
+		{
+			Name:        "not representable",
+			Charset:     "iso-8859-2",
+			Text:        "日本語",
+			Encode:      func(b *email.EmailBuilder, s string) error { return b.SetPlainBody([]byte(s)) },
+			ExpectedErr: true,
+		},
+		{
+			Name:        "unsupported charset",
+			Charset:     "x-unknown",
+			Text:        "Hello",
+			Encode:      func(b *email.EmailBuilder, s string) error { return b.EncodeQuotedPlain([]byte(s)) },
+			ExpectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.SetPlainCharset(c.Charset)
+			err := c.Encode(b, c.Text)
+			if c.ExpectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.ExpectedEncoding, b.PlainHeaders.Get("Content-Transfer-Encoding"))
+
+			w := &bytes.Buffer{}
+			err = b.Write(w)
+			assert.NoError(t, err)
+			assert.Contains(t, w.String(), "Content-Type: text/plain; charset="+c.Charset+"\r\n")
+
+			parsed, err := email.Parse(w)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, string(parsed.Body.Body))
+
+			content, err := parsed.Body.Content()
+			assert.NoError(t, err)
+			enc, err := ianaindex.MIME.Encoding(c.Charset)
+			assert.NoError(t, err)
+			decoded, err := enc.NewDecoder().Bytes(content)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Text, string(decoded))
+		})
+	}
+}
+
+func TestEmailBuilderStreamCharsetNotRepresentable(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.SetPlainCharset("iso-8859-2")
+	err := b.StreamQuotedPlain(strings.NewReader("日本語"))
+	assert.NoError(t, err)
+
+	err = b.Write(io.Discard)
+	assert.Error(t, err)
+}
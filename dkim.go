@@ -0,0 +1,325 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM canonicalization algorithms (RFC 6376 section 3.4).
+const (
+	DKIMSimple  = "simple"
+	DKIMRelaxed = "relaxed"
+)
+
+// maxDKIMSignatureLineLength is the length of the lines
+// of the folded signature value.
+const maxDKIMSignatureLineLength = 76
+
+// DefaultDKIMHeaders are the header fields signed by default
+// if they are present in the message.
+var DefaultDKIMHeaders = []string{
+	"From",
+	"Sender",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Subject",
+	"Date",
+	"Message-ID",
+	"In-Reply-To",
+	"References",
+	"MIME-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+// DKIMSigner computes DKIM signatures (RFC 6376) of messages.
+// RSA keys are used with the rsa-sha256 algorithm
+// and Ed25519 keys with the ed25519-sha256 algorithm (RFC 8463).
+type DKIMSigner struct {
+	// Domain is the signing domain (d= tag).
+	Domain string
+
+	// Selector is the selector of the public key
+	// in the DNS of the signing domain (s= tag).
+	Selector string
+
+	// Key is the private key, either an *rsa.PrivateKey
+	// or an ed25519.PrivateKey.
+	Key crypto.Signer
+
+	// Headers are the names of the signed header fields (h= tag).
+	// Defaults to the fields of DefaultDKIMHeaders present in the message.
+	Headers []string
+
+	// HeaderCanonicalization is the canonicalization algorithm
+	// of the header, DKIMSimple or DKIMRelaxed. Defaults to DKIMRelaxed.
+	HeaderCanonicalization string
+
+	// BodyCanonicalization is the canonicalization algorithm
+	// of the body, DKIMSimple or DKIMRelaxed. Defaults to DKIMSimple.
+	BodyCanonicalization string
+
+	// Identifier is the optional agent or user identifier (i= tag).
+	Identifier string
+}
+
+func NewDKIMSigner(domain, selector string, key crypto.Signer) *DKIMSigner {
+	return &DKIMSigner{
+		Domain:   domain,
+		Selector: selector,
+		Key:      key,
+	}
+}
+
+// Signature computes the signature of msg in wire format
+// and returns the DKIM-Signature header field to be prepended
+// to the message, including the trailing \r\n.
+func (s *DKIMSigner) Signature(msg []byte) (string, error) {
+	if s.Domain == "" || s.Selector == "" {
+		return "", fmt.Errorf("missing DKIM domain or selector")
+	}
+	if s.Key == nil {
+		return "", fmt.Errorf("missing DKIM key")
+	}
+
+	var algorithm string
+	var opts crypto.SignerOpts
+	switch s.Key.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = "rsa-sha256"
+		opts = crypto.SHA256
+	case ed25519.PublicKey:
+		algorithm = "ed25519-sha256"
+		opts = crypto.Hash(0)
+	default:
+		return "", fmt.Errorf("unsupported DKIM key type %T", s.Key.Public())
+	}
+
+	headerCanon := s.HeaderCanonicalization
+	if headerCanon == "" {
+		headerCanon = DKIMRelaxed
+	}
+	bodyCanon := s.BodyCanonicalization
+	if bodyCanon == "" {
+		bodyCanon = DKIMSimple
+	}
+	if !isDKIMCanonicalization(headerCanon) || !isDKIMCanonicalization(bodyCanon) {
+		return "", fmt.Errorf("unsupported DKIM canonicalization %s/%s", headerCanon, bodyCanon)
+	}
+
+	fields, body, err := splitRawHeader(normalizeNewlines(msg))
+	if err != nil {
+		return "", err
+	}
+
+	keys := s.Headers
+	if keys == nil {
+		for _, k := range DefaultDKIMHeaders {
+			for _, f := range fields {
+				if strings.EqualFold(f.Key, k) {
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	hasFrom := false
+	for _, k := range keys {
+		hasFrom = hasFrom || strings.EqualFold(k, "From")
+	}
+	if !hasFrom {
+		return "", fmt.Errorf("the From header field must be signed")
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeBody(bodyCanon, body))
+
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=" + headerCanon + "/" + bodyCanon,
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+	}
+	if s.Identifier != "" {
+		tags = append(tags, "i="+s.Identifier)
+	}
+	tags = append(tags,
+		"t="+strconv.FormatInt(time.Now().Unix(), 10),
+		"h="+strings.ToLower(strings.Join(keys, ":")),
+		"bh="+base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	)
+	line, err := foldHeaderField("DKIM-Signature", strings.Join(tags, "; "))
+	if err != nil {
+		return "", err
+	}
+
+	hash := dkimHeaderHash(headerCanon, fields, keys, line)
+	sig, err := s.Key.Sign(rand.Reader, hash, opts)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteString(line)
+	b := base64.StdEncoding.EncodeToString(sig)
+	for len(b) > 0 {
+		n := maxDKIMSignatureLineLength
+		if n > len(b) {
+			n = len(b)
+		}
+		buf.WriteString("\r\n ")
+		buf.WriteString(b[:n])
+		b = b[n:]
+	}
+	buf.WriteString("\r\n")
+	return buf.String(), nil
+}
+
+// isDKIMCanonicalization reports whether c is
+// a supported canonicalization algorithm.
+func isDKIMCanonicalization(c string) bool {
+	return c == DKIMSimple || c == DKIMRelaxed
+}
+
+// rawHeaderField is a header field in wire format.
+type rawHeaderField struct {
+	// Key is the name of the field.
+	Key string
+
+	// Raw is the folded field including the trailing \r\n.
+	Raw string
+}
+
+// splitRawHeader splits msg into the header fields in wire format
+// and the body.
+func splitRawHeader(msg []byte) ([]rawHeaderField, []byte, error) {
+	var fields []rawHeaderField
+	for len(msg) > 0 {
+		i := bytes.Index(msg, []byte("\r\n"))
+		if i == -1 {
+			i = len(msg)
+		} else {
+			i += 2
+		}
+		line := string(msg[:i])
+		if line == "\r\n" {
+			return fields, msg[i:], nil
+		}
+		msg = msg[i:]
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("malformed header: continuation line without a header field: %q", line)
+			}
+			fields[len(fields)-1].Raw += line
+			continue
+		}
+		j := strings.IndexByte(line, ':')
+		if j <= 0 {
+			return nil, nil, fmt.Errorf("malformed header line: %q", line)
+		}
+		fields = append(fields, rawHeaderField{
+			Key: strings.TrimSpace(line[:j]),
+			Raw: line,
+		})
+	}
+	return fields, nil, nil
+}
+
+// selectHeaderFields returns the raw header fields in the order of keys.
+// Repeated keys select the fields of the same name
+// from the bottom of the header up (RFC 6376 section 5.4.2).
+// Keys without a remaining field are skipped.
+func selectHeaderFields(fields []rawHeaderField, keys []string) []string {
+	used := make(map[int]bool)
+	var selected []string
+	for _, k := range keys {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].Key, k) {
+				used[i] = true
+				selected = append(selected, fields[i].Raw)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// dkimHeaderHash computes the SHA-256 hash of the header fields
+// selected by keys and the DKIM-Signature header field sig
+// without the value of the b= tag and the trailing \r\n,
+// canonicalized with the c algorithm.
+func dkimHeaderHash(c string, fields []rawHeaderField, keys []string, sig string) []byte {
+	h := sha256.New()
+	for _, raw := range selectHeaderFields(fields, keys) {
+		h.Write([]byte(canonicalizeHeader(c, raw)))
+	}
+	h.Write([]byte(strings.TrimSuffix(canonicalizeHeader(c, sig+"\r\n"), "\r\n")))
+	return h.Sum(nil)
+}
+
+// canonicalizeHeader canonicalizes the raw header field
+// with the c algorithm.
+func canonicalizeHeader(c, raw string) string {
+	if c == DKIMSimple {
+		return raw
+	}
+	i := strings.IndexByte(raw, ':')
+	key := strings.ToLower(strings.TrimSpace(raw[:i]))
+	value := strings.ReplaceAll(raw[i+1:], "\r\n", "")
+	return key + ":" + strings.TrimSpace(compressWhitespace(value)) + "\r\n"
+}
+
+// canonicalizeBody canonicalizes the body with the c algorithm.
+func canonicalizeBody(c string, body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	if c == DKIMRelaxed {
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(compressWhitespace(l), " ")
+		}
+	}
+
+	// The empty lines at the end of the body are ignored.
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if c == DKIMSimple {
+			return []byte("\r\n")
+		}
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compressWhitespace replaces the sequences of spaces and tabs
+// in s with a single space.
+func compressWhitespace(s string) string {
+	buf := &strings.Builder{}
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteByte(s[i])
+	}
+	if space {
+		buf.WriteByte(' ')
+	}
+	return buf.String()
+}
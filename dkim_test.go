@@ -0,0 +1,269 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testEd25519Key = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
+// The canonicalization example of RFC 6376 section 3.4.5.
+const dkimExampleMessage = "A: X\r\n" +
+	"B : Y\t\r\n" +
+	"\tZ  \r\n" +
+	"\r\n" +
+	" C \r\n" +
+	"D \t E\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// dkimTags parses the tags of the DKIM-Signature header field sig.
+func dkimTags(t *testing.T, sig string) map[string]string {
+	value := strings.TrimPrefix(strings.ReplaceAll(sig, "\r\n", ""), "DKIM-Signature: ")
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(value, ";") {
+		kv := strings.SplitN(tag, "=", 2)
+		if assert.Len(t, kv, 2, tag) {
+			tags[strings.TrimSpace(kv[0])] = strings.Join(strings.Fields(kv[1]), "")
+		}
+	}
+	return tags
+}
+
+// verifyDKIMSignature verifies the signature in the sig header field
+// computed over the canonicalized headers and body.
+func verifyDKIMSignature(t *testing.T, sig, headers, body string, pub crypto.PublicKey) {
+	tags := dkimTags(t, sig)
+	bh := sha256.Sum256([]byte(body))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(bh[:]), tags["bh"])
+
+	// The signature header field without the value of the b= tag.
+	signed := strings.TrimSuffix(sig, "\r\n")
+	signed = signed[:strings.LastIndex(signed, " b=")+len(" b=")]
+	if strings.HasPrefix(tags["c"], "relaxed/") {
+		signed = "dkim-signature:" + strings.TrimPrefix(strings.ReplaceAll(signed, "\r\n", ""), "DKIM-Signature: ")
+	}
+	digest := sha256.Sum256([]byte(headers + signed))
+
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+	assert.NoError(t, err)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		assert.Equal(t, "rsa-sha256", tags["a"])
+		assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], b))
+	case ed25519.PublicKey:
+		assert.Equal(t, "ed25519-sha256", tags["a"])
+		assert.True(t, ed25519.Verify(pub, digest[:], b), "invalid signature")
+	}
+}
+
+func TestDKIMSignerCanonicalization(t *testing.T) {
+	cases := []struct {
+		Header          string
+		Body            string
+		ExpectedHeaders string
+		ExpectedBody    string
+	}{
+		{
+			Header:          email.DKIMRelaxed,
+			Body:            email.DKIMRelaxed,
+			ExpectedHeaders: "a:X\r\nb:Y Z\r\n",
+			ExpectedBody:    " C\r\nD E\r\n",
+		},
+		{
+			Header:          email.DKIMSimple,
+			Body:            email.DKIMSimple,
+			ExpectedHeaders: "A: X\r\nB : Y\t\r\n\tZ  \r\n",
+			ExpectedBody:    " C \r\nD \t E\r\n",
+		},
+		{
+			Header:          email.DKIMRelaxed,
+			Body:            email.DKIMSimple,
+			ExpectedHeaders: "a:X\r\nb:Y Z\r\n",
+			ExpectedBody:    " C \r\nD \t E\r\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Header+"/"+c.Body, func(t *testing.T) {
+			s := email.NewDKIMSigner("example.com", "sel", testEd25519Key)
+			s.Headers = []string{"From", "A", "B"}
+			s.HeaderCanonicalization = c.Header
+			s.BodyCanonicalization = c.Body
+
+			sig, err := s.Signature([]byte(dkimExampleMessage))
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(strings.ReplaceAll(sig, "\r\n", ""), "DKIM-Signature: v=1; a=ed25519-sha256; c="+c.Header+"/"+c.Body+"; d=example.com; s=sel; t="))
+			assert.Equal(t, "from:a:b", dkimTags(t, sig)["h"])
+			verifyDKIMSignature(t, sig, c.ExpectedHeaders, c.ExpectedBody, testEd25519Key.Public())
+
+			for _, line := range strings.Split(sig, "\r\n") {
+				assert.LessOrEqual(t, len(line), 78, line)
+			}
+		})
+	}
+}
+
+func TestDKIMSignerEmptyBody(t *testing.T) {
+	cases := []struct {
+		Body         string
+		ExpectedBody string
+	}{
+		{Body: email.DKIMSimple, ExpectedBody: "\r\n"},
+		{Body: email.DKIMRelaxed, ExpectedBody: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Body, func(t *testing.T) {
+			s := email.NewDKIMSigner("example.com", "sel", testEd25519Key)
+			s.BodyCanonicalization = c.Body
+			sig, err := s.Signature([]byte("From: hello@example.com\r\n\r\n\r\n"))
+			assert.NoError(t, err)
+			verifyDKIMSignature(t, sig, "from:hello@example.com\r\n", c.ExpectedBody, testEd25519Key.Public())
+		})
+	}
+}
+
+func TestEmailBuilderDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	b := email.NewEmailBuilder()
+	err = b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Hello  world")
+	b.Boundary = email.DefaultBoundary
+	b.EncodeQuotedPlain([]byte("Hello world\r\n\r\n"))
+	b.Attach("invoice.pdf", []byte("%PDF-1.4"))
+
+	rsaSigner := email.NewDKIMSigner("example.com", "rsa", rsaKey)
+	rsaSigner.Headers = []string{"From", "Subject"}
+	edSigner := email.NewDKIMSigner("example.com", "ed", testEd25519Key)
+	edSigner.Headers = []string{"From", "Subject"}
+	edSigner.Identifier = "@example.com"
+	b.DKIMSigners = []*email.DKIMSigner{rsaSigner, edSigner}
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg := w.String()
+	i := strings.Index(msg, "\r\nFrom: ")
+	if !assert.NotEqual(t, -1, i) {
+		return
+	}
+	signatures := strings.SplitAfter(msg[:i+2], "\r\nDKIM-Signature: ")
+	if !assert.Len(t, signatures, 2) {
+		return
+	}
+	rsaSig := strings.TrimSuffix(signatures[0], "DKIM-Signature: ")
+	edSig := "DKIM-Signature: " + signatures[1]
+	assert.Equal(t, "rsa", dkimTags(t, rsaSig)["s"])
+	assert.Equal(t, "ed", dkimTags(t, edSig)["s"])
+	assert.Equal(t, "@example.com", dkimTags(t, edSig)["i"])
+
+	// The message following the signatures is the unsigned message.
+	unsigned := msg[i+2:]
+	body := unsigned[strings.Index(unsigned, "\r\n\r\n")+4:]
+	body = strings.TrimRight(body, "\r\n") + "\r\n"
+	headers := "from:hello@example.com\r\nsubject:Hello world\r\n"
+	verifyDKIMSignature(t, rsaSig, headers, body, rsaKey.Public())
+	verifyDKIMSignature(t, edSig, headers, body, testEd25519Key.Public())
+}
+
+func TestEmailBuilderDKIMDefaultHeaders(t *testing.T) {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Hello")
+	b.Headers.Add("X-Mailer", "email")
+	b.EncodeQuotedPlain([]byte("Hello world"))
+	b.DKIMSigners = []*email.DKIMSigner{email.NewDKIMSigner("example.com", "ed", testEd25519Key)}
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	sig := w.String()[:strings.Index(w.String(), "\r\nFrom: ")+2]
+	tags := dkimTags(t, sig)
+	assert.Equal(t, "relaxed/simple", tags["c"])
+	assert.Equal(t, "from:to:subject:date:message-id:mime-version:content-type:content-transfer-encoding", tags["h"])
+}
+
+func TestDKIMSignerErrors(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	msg := []byte("From: hello@example.com\r\nSubject: Hello\r\n\r\nHello")
+
+	cases := []struct {
+		Name   string
+		Signer *email.DKIMSigner
+		Msg    []byte
+	}{
+		{
+			Name:   "missing domain",
+			Signer: email.NewDKIMSigner("", "sel", testEd25519Key),
+			Msg:    msg,
+		},
+		{
+			Name:   "missing key",
+			Signer: email.NewDKIMSigner("example.com", "sel", nil),
+			Msg:    msg,
+		},
+		{
+			Name:   "unsupported key",
+			Signer: email.NewDKIMSigner("example.com", "sel", ecKey),
+			Msg:    msg,
+		},
+		{
+			Name: "unsupported canonicalization",
+			Signer: &email.DKIMSigner{
+				Domain:                 "example.com",
+				Selector:               "sel",
+				Key:                    testEd25519Key,
+				HeaderCanonicalization: "nowsp",
+			},
+			Msg: msg,
+		},
+		{
+			Name: "from not signed",
+			Signer: &email.DKIMSigner{
+				Domain:   "example.com",
+				Selector: "sel",
+				Key:      testEd25519Key,
+				Headers:  []string{"Subject"},
+			},
+			Msg: msg,
+		},
+		{
+			Name:   "malformed header",
+			Signer: email.NewDKIMSigner("example.com", "sel", testEd25519Key),
+			Msg:    []byte("From hello@example.com\r\n\r\nHello"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := c.Signer.Signature(c.Msg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package email
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIMKeyLookup looks up the DKIM public key records.
+type DKIMKeyLookup interface {
+	// LookupTXT returns the TXT records of the name domain,
+	// e.g. selector._domainkey.example.com.
+	LookupTXT(name string) ([]string, error)
+}
+
+// DKIMLookupFunc adapts an ordinary function to the DKIMKeyLookup interface.
+type DKIMLookupFunc func(name string) ([]string, error)
+
+// LookupTXT calls f(name).
+func (f DKIMLookupFunc) LookupTXT(name string) ([]string, error) {
+	return f(name)
+}
+
+// DNSLookup looks up the DKIM public key records in the DNS.
+var DNSLookup DKIMKeyLookup = DKIMLookupFunc(net.LookupTXT)
+
+// DKIMVerifier verifies the DKIM signatures (RFC 6376) of messages.
+// The rsa-sha256 and ed25519-sha256 algorithms are supported.
+type DKIMVerifier struct {
+	// Lookup looks up the public keys of the signing domains.
+	// Defaults to DNSLookup.
+	Lookup DKIMKeyLookup
+}
+
+func NewDKIMVerifier(lookup DKIMKeyLookup) *DKIMVerifier {
+	return &DKIMVerifier{
+		Lookup: lookup,
+	}
+}
+
+// DKIMResult is the result of the verification of a DKIM signature.
+type DKIMResult struct {
+	// Domain is the signing domain (d= tag).
+	Domain string
+
+	// Selector is the selector of the public key (s= tag).
+	Selector string
+
+	// Identifier is the agent or user identifier (i= tag).
+	Identifier string
+
+	// Err is the reason of the failure.
+	// It is nil if the signature is valid.
+	Err error
+}
+
+// Pass reports whether the signature is valid.
+func (r *DKIMResult) Pass() bool {
+	return r.Err == nil
+}
+
+// Verify verifies the DKIM-Signature header fields of msg in wire format
+// and returns a result for each of them in the order of the header.
+// It returns an error only if the header of msg can not be parsed.
+func (v *DKIMVerifier) Verify(msg []byte) ([]*DKIMResult, error) {
+	fields, body, err := splitRawHeader(normalizeNewlines(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*DKIMResult
+	for _, f := range fields {
+		if !strings.EqualFold(f.Key, "DKIM-Signature") {
+			continue
+		}
+		results = append(results, v.verifySignature(fields, body, f.Raw))
+	}
+	return results, nil
+}
+
+// verifySignature verifies the raw DKIM-Signature header field.
+func (v *DKIMVerifier) verifySignature(fields []rawHeaderField, body []byte, raw string) *DKIMResult {
+	r := &DKIMResult{}
+	tags, err := parseDKIMTags(raw[strings.IndexByte(raw, ':')+1:])
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Domain = tags["d"]
+	r.Selector = tags["s"]
+	r.Identifier = tags["i"]
+
+	for _, t := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[t]; !ok {
+			r.Err = fmt.Errorf("missing %s= tag", t)
+			return r
+		}
+	}
+	if tags["v"] != "1" {
+		r.Err = fmt.Errorf("unsupported version %q", tags["v"])
+		return r
+	}
+
+	var keyType string
+	switch tags["a"] {
+	case "rsa-sha256":
+		keyType = "rsa"
+	case "ed25519-sha256":
+		keyType = "ed25519"
+	default:
+		r.Err = fmt.Errorf("unsupported algorithm %q", tags["a"])
+		return r
+	}
+
+	headerCanon, bodyCanon := DKIMSimple, DKIMSimple
+	if c, ok := tags["c"]; ok {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanon = parts[0]
+		if len(parts) == 2 {
+			bodyCanon = parts[1]
+		}
+	}
+	if !isDKIMCanonicalization(headerCanon) || !isDKIMCanonicalization(bodyCanon) {
+		r.Err = fmt.Errorf("unsupported canonicalization %q", tags["c"])
+		return r
+	}
+
+	var keys []string
+	hasFrom := false
+	for _, k := range strings.Split(tags["h"], ":") {
+		k = strings.TrimSpace(k)
+		keys = append(keys, k)
+		hasFrom = hasFrom || strings.EqualFold(k, "From")
+	}
+	if !hasFrom {
+		r.Err = fmt.Errorf("the From header field is not signed")
+		return r
+	}
+
+	if r.Identifier != "" {
+		at := strings.LastIndexByte(r.Identifier, '@')
+		domain := strings.ToLower(r.Identifier[at+1:])
+		d := strings.ToLower(r.Domain)
+		if domain != d && !strings.HasSuffix(domain, "."+d) {
+			r.Err = fmt.Errorf("identifier %q is not in the signing domain %q", r.Identifier, r.Domain)
+			return r
+		}
+	}
+
+	if x, ok := tags["x"]; ok {
+		expiration, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			r.Err = fmt.Errorf("invalid x= tag %q", x)
+			return r
+		}
+		if time.Now().Unix() > expiration {
+			r.Err = fmt.Errorf("signature expired at %s", time.Unix(expiration, 0).UTC().Format(time.RFC3339))
+			return r
+		}
+	}
+
+	canonBody := canonicalizeBody(bodyCanon, body)
+	if l, ok := tags["l"]; ok {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 0 {
+			r.Err = fmt.Errorf("invalid l= tag %q", l)
+			return r
+		}
+		if n > int64(len(canonBody)) {
+			r.Err = fmt.Errorf("body shorter than the l= tag %d", n)
+			return r
+		}
+		canonBody = canonBody[:n]
+	}
+	bodyHash := sha256.Sum256(canonBody)
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		r.Err = fmt.Errorf("body hash mismatch")
+		return r
+	}
+
+	key, err := v.lookupKey(r.Domain, r.Selector, keyType)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		r.Err = fmt.Errorf("invalid b= tag: %w", err)
+		return r
+	}
+
+	hash := dkimHeaderHash(headerCanon, fields, keys, stripDKIMSignatureValue(strings.TrimSuffix(raw, "\r\n")))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash, sig)
+		if err != nil {
+			r.Err = fmt.Errorf("signature verification failed: %w", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, hash, sig) {
+			r.Err = fmt.Errorf("signature verification failed")
+		}
+	}
+	return r
+}
+
+// lookupKey looks up the public key of the selector in domain
+// and verifies that its type is keyType.
+func (v *DKIMVerifier) lookupKey(domain, selector, keyType string) (crypto.PublicKey, error) {
+	lookup := v.Lookup
+	if lookup == nil {
+		lookup = DNSLookup
+	}
+
+	name := selector + "._domainkey." + domain
+	records, err := lookup.LookupTXT(name)
+	if err != nil {
+		return nil, fmt.Errorf("key lookup of %s failed: %w", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no key for %s", name)
+	}
+
+	tags, err := parseDKIMTags(records[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key record of %s: %w", name, err)
+	}
+	if ver, ok := tags["v"]; ok && ver != "DKIM1" {
+		return nil, fmt.Errorf("unsupported key record version %q", ver)
+	}
+	if h, ok := tags["h"]; ok && !containsFold(strings.Split(h, ":"), "sha256") {
+		return nil, fmt.Errorf("key of %s does not allow sha256", name)
+	}
+	k := tags["k"]
+	if k == "" {
+		k = "rsa"
+	}
+	if k != keyType {
+		return nil, fmt.Errorf("key type %q does not match the algorithm", k)
+	}
+
+	p, ok := tags["p"]
+	if !ok {
+		return nil, fmt.Errorf("missing p= tag in the key record of %s", name)
+	}
+	if p == "" {
+		return nil, fmt.Errorf("key of %s revoked", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key of %s: %w", name, err)
+	}
+
+	switch k {
+	case "rsa":
+		key, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// Some records contain a PKCS #1 RSAPublicKey.
+			key, err = x509.ParsePKCS1PublicKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key of %s: %w", name, err)
+			}
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key of %s is not an RSA key", name)
+		}
+		return rsaKey, nil
+	default:
+		if len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length %d of %s", len(data), name)
+		}
+		return ed25519.PublicKey(data), nil
+	}
+}
+
+// parseDKIMTags parses a DKIM tag list (RFC 6376 section 3.2).
+// The whitespaces are removed from the values.
+func parseDKIMTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(s, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		i := strings.IndexByte(spec, '=')
+		if i == -1 {
+			return nil, fmt.Errorf("malformed tag %q", strings.TrimSpace(spec))
+		}
+		name := strings.TrimSpace(spec[:i])
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("duplicate tag %q", name)
+		}
+		tags[name] = strings.Join(strings.Fields(spec[i+1:]), "")
+	}
+	return tags, nil
+}
+
+// stripDKIMSignatureValue returns the raw DKIM-Signature header field
+// with the value of the b= tag deleted.
+func stripDKIMSignatureValue(raw string) string {
+	pos := strings.IndexByte(raw, ':') + 1
+	for pos < len(raw) {
+		end := strings.IndexByte(raw[pos:], ';')
+		if end == -1 {
+			end = len(raw)
+		} else {
+			end += pos
+		}
+		spec := raw[pos:end]
+		i := strings.IndexByte(spec, '=')
+		if i != -1 && strings.TrimSpace(spec[:i]) == "b" {
+			return raw[:pos+i+1] + raw[end:]
+		}
+		pos = end + 1
+	}
+	return raw
+}
+
+// containsFold reports whether list contains s
+// under Unicode case-folding.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
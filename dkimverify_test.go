@@ -0,0 +1,267 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dkimKeyStore is an in-memory DKIM key store.
+type dkimKeyStore map[string]string
+
+func (s dkimKeyStore) LookupTXT(name string) ([]string, error) {
+	record, ok := s[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []string{record}, nil
+}
+
+// The example of RFC 8463 Appendix A.
+const rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=test; t=1528637909; h=from : to : subject :\r\n" +
+	" date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3\r\n" +
+	" DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz\r\n" +
+	" dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+func TestDKIMVerifierRFC8463(t *testing.T) {
+	keys := dkimKeyStore{
+		"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+		"test._domainkey.football.example.com": "v=DKIM1; k=rsa; " +
+			"p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+	}
+
+	results, err := email.NewDKIMVerifier(keys).Verify([]byte(rfc8463Message))
+	assert.NoError(t, err)
+	if !assert.Len(t, results, 2) {
+		return
+	}
+	for _, r := range results {
+		assert.NoError(t, r.Err, r.Selector)
+		assert.True(t, r.Pass())
+		assert.Equal(t, "football.example.com", r.Domain)
+		assert.Equal(t, "@football.example.com", r.Identifier)
+	}
+	assert.Equal(t, "brisbane", results[0].Selector)
+	assert.Equal(t, "test", results[1].Selector)
+}
+
+func TestDKIMVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaPub, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	assert.NoError(t, err)
+
+	keys := dkimKeyStore{
+		"rsa._domainkey.example.com": "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(rsaPub),
+		"ed._domainkey.example.com":  "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(testEd25519Key[32:]),
+		"rsa1._domainkey.example.com": "v=DKIM1; k=rsa; p=" +
+			base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)),
+		"revoked._domainkey.example.com":  "v=DKIM1; k=ed25519; p=",
+		"mismatch._domainkey.example.com": "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(testEd25519Key[32:]),
+	}
+
+	sign := func(t *testing.T, selector, canon string) string {
+		b := email.NewEmailBuilder()
+		err := b.SetFrom("Szakszon Péter <peter@example.com>")
+		assert.NoError(t, err)
+		err = b.SetTo([]string{"alice@example.com"})
+		assert.NoError(t, err)
+		b.SetSubject("Hello  world")
+		b.EncodeQuotedPlain([]byte("Hello world  \r\n\r\n"))
+
+		s := email.NewDKIMSigner("example.com", selector, testEd25519Key)
+		if strings.HasPrefix(selector, "rsa") || selector == "mismatch" {
+			s.Key = rsaKey
+		}
+		if canon != "" {
+			parts := strings.Split(canon, "/")
+			s.HeaderCanonicalization = parts[0]
+			s.BodyCanonicalization = parts[1]
+		}
+		b.DKIMSigners = []*email.DKIMSigner{s}
+
+		w := &bytes.Buffer{}
+		err = b.Write(w)
+		assert.NoError(t, err)
+		return w.String()
+	}
+
+	cases := []struct {
+		Name     string
+		Selector string
+		Canon    string
+		Modify   func(msg string) string
+		Error    string
+	}{
+		{
+			Name:     "rsa",
+			Selector: "rsa",
+		},
+		{
+			Name:     "ed25519",
+			Selector: "ed",
+		},
+		{
+			Name:     "pkcs1 key",
+			Selector: "rsa1",
+		},
+		{
+			Name:     "simple/simple",
+			Selector: "ed",
+			Canon:    "simple/simple",
+		},
+		{
+			Name:     "relaxed/relaxed",
+			Selector: "ed",
+			Canon:    "relaxed/relaxed",
+		},
+		{
+			Name:     "relaxed header refolded",
+			Selector: "ed",
+			Canon:    "relaxed/relaxed",
+			Modify: func(msg string) string {
+				msg = strings.Replace(msg, "Subject: Hello  world", "subject:\tHello\r\n world", 1)
+				return strings.Replace(msg, "Hello world  \r\n", "Hello   world\r\n", 1)
+			},
+		},
+		{
+			Name:     "simple header refolded",
+			Selector: "ed",
+			Canon:    "simple/simple",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "Subject: Hello  world", "Subject: Hello world", 1)
+			},
+			Error: "signature verification failed",
+		},
+		{
+			Name:     "modified header",
+			Selector: "rsa",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "Subject: Hello  world", "Subject: Hi", 1)
+			},
+			Error: "signature verification failed",
+		},
+		{
+			Name:     "modified body",
+			Selector: "ed",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "Hello world", "Bye world", 1)
+			},
+			Error: "body hash mismatch",
+		},
+		{
+			Name:     "unknown selector",
+			Selector: "unknown",
+			Error:    "key lookup of unknown._domainkey.example.com failed",
+		},
+		{
+			Name:     "revoked key",
+			Selector: "revoked",
+			Error:    "revoked",
+		},
+		{
+			Name:     "key type mismatch",
+			Selector: "mismatch",
+			Error:    "invalid key",
+		},
+		{
+			Name:     "expired",
+			Selector: "ed",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "v=1;", "v=1; x=1;", 1)
+			},
+			Error: "signature expired",
+		},
+		{
+			Name:     "identifier outside the domain",
+			Selector: "ed",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "v=1;", "v=1; i=@example.org;", 1)
+			},
+			Error: "is not in the signing domain",
+		},
+		{
+			Name:     "unsupported algorithm",
+			Selector: "ed",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "a=ed25519-sha256", "a=rsa-sha1", 1)
+			},
+			Error: "unsupported algorithm",
+		},
+		{
+			Name:     "duplicate tag",
+			Selector: "ed",
+			Modify: func(msg string) string {
+				return strings.Replace(msg, "v=1;", "v=1; v=1;", 1)
+			},
+			Error: "duplicate tag",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			msg := sign(t, c.Selector, c.Canon)
+			if c.Modify != nil {
+				msg = c.Modify(msg)
+			}
+
+			results, err := email.NewDKIMVerifier(keys).Verify([]byte(msg))
+			assert.NoError(t, err)
+			if !assert.Len(t, results, 1) {
+				return
+			}
+			r := results[0]
+			if c.Error == "" {
+				assert.Equal(t, "example.com", r.Domain)
+				assert.Equal(t, c.Selector, r.Selector)
+				assert.NoError(t, r.Err)
+				assert.True(t, r.Pass())
+				return
+			}
+			assert.False(t, r.Pass())
+			if assert.Error(t, r.Err) {
+				assert.Contains(t, r.Err.Error(), c.Error)
+			}
+		})
+	}
+}
+
+func TestDKIMVerifierUnsigned(t *testing.T) {
+	results, err := email.NewDKIMVerifier(dkimKeyStore{}).Verify([]byte("From: hello@example.com\r\n\r\nHello"))
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = email.NewDKIMVerifier(dkimKeyStore{}).Verify([]byte("From hello@example.com\r\n\r\nHello"))
+	assert.Error(t, err)
+}
@@ -2,65 +2,129 @@ package email
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/quotedprintable"
-	"net/http"
 	"strings"
 	"time"
 )
 
+// DefaultBoundary is a fixed boundary. Set it in the Boundary field
+// to get a deterministic output, e.g. in tests.
 const DefaultBoundary = "110000000000863a1705ddeb4f86"
 
 func NewEmailBuilder() *EmailBuilder {
-	return &EmailBuilder{
-		Headers:      make(http.Header),
-		PlainHeaders: make(http.Header),
-		HTMLHeaders:  make(http.Header),
-	}
+	return &EmailBuilder{}
 }
 
 // EmailBuilder helps build a multipart email message
 // in MIME (Multipurpose Internet Mail Extensions) encoding.
 type EmailBuilder struct {
 	// Headers stores the custom key-value pairs of a MIME message.
-	Headers http.Header
+	Headers Header
+
+	// HeaderOrder is the order in which the message header fields
+	// are written. The fields not listed are written after the listed ones
+	// in the order they were added. Defaults to DefaultHeaderOrder.
+	// Set it to an empty non-nil slice to write the fields
+	// exactly in the order they were added.
+	HeaderOrder []string
+
+	// HeaderCharset is the charset of the RFC 2047 encoded-words
+	// used for the non-ASCII header values and display names.
+	// Defaults to DefaultHeaderCharset.
+	HeaderCharset string
+
+	// MessageIDDomain is the domain of the generated Message-ID.
+	// Defaults to the domain of the From address.
+	MessageIDDomain string
 
 	// Boundary is the custom boundary.
 	// Used only if the Headers does not contain a Content-Type header.
 	// If the Headers contains a Content-Type header, the boundary
 	// will be parsed from the header value.
+	// If both are empty a random boundary will be generated.
 	Boundary string
 
+	// randomBoundary is the generated boundary
+	// used if no custom boundary is specified.
+	randomBoundary string
+
 	// PlainHeaders stores the custom key-value pairs for the plain body part.
-	PlainHeaders http.Header
+	PlainHeaders Header
 
 	// Plain is the encoded plain text body part in wire format without the trailing \r\n.
 	Plain bytes.Buffer
 
+	// PlainReader supplies the unencoded plain text body.
+	// If set, it is used instead of Plain and encoded on the fly
+	// when the email is written.
+	PlainReader io.Reader
+
 	// HTMLHeaders stores the custom key-value pairs for the HTML body part.
-	HTMLHeaders http.Header
+	HTMLHeaders Header
 
 	// HTML is the encoded HTML text body part in wire format without the trailing \r\n.
 	HTML bytes.Buffer
-}
-
-// SetFrom creates the From header.
-func (b *EmailBuilder) SetFrom(from string) {
-	b.Headers.Set("From", from)
-}
 
-// SetTo creates the To header.
-func (b *EmailBuilder) SetTo(to []string) {
-	buf := &bytes.Buffer{}
-	for i, s := range to {
-		if i > 0 {
-			buf.WriteString(", ")
-		}
-		buf.WriteString(s)
-	}
-	b.Headers.Set("To", buf.String())
+	// HTMLReader supplies the unencoded HTML text body.
+	// If set, it is used instead of HTML and encoded on the fly
+	// when the email is written.
+	HTMLReader io.Reader
+
+	// GeneratePlain derives the plain text body from the HTML body
+	// with the PlainFromHTML function if the email has no plain text
+	// body, so both are written in a multipart/alternative part.
+	GeneratePlain bool
+
+	// Calendar is the text/calendar part of a calendar invitation.
+	// It is written as the last alternative of the plain
+	// and the HTML body parts.
+	Calendar *Part
+
+	// Attachments stores the files attached to the email.
+	Attachments []*Attachment
+
+	// Inlines stores the resources embedded in the HTML body.
+	// The HTML body can reference them by their Content-ID
+	// using cid: URLs.
+	Inlines []*Attachment
+
+	// SMIMESigner signs the body of the message with S/MIME.
+	// The body is wrapped in a multipart/signed part.
+	SMIMESigner *SMIMESigner
+
+	// SMIMEEncryptor encrypts the body of the message with S/MIME
+	// after it has been signed. The body is replaced with
+	// an application/pkcs7-mime part.
+	SMIMEEncryptor *SMIMEEncryptor
+
+	// PGPSigner signs the body of the message with PGP/MIME.
+	// The body is wrapped in a multipart/signed part.
+	PGPSigner PGPSigner
+
+	// PGPEncryptor encrypts the body of the message with PGP/MIME
+	// after it has been signed. The body is wrapped
+	// in a multipart/encrypted part.
+	PGPEncryptor PGPEncryptor
+
+	// DKIMSigners sign the written message. Their DKIM-Signature
+	// header fields are prepended to the message in order.
+	DKIMSigners []*DKIMSigner
+
+	// Body is the root part of a custom MIME structure.
+	// If set, it will be written instead of the Plain, HTML,
+	// Inlines and Attachments fields.
+	// Its Content-Type and other content headers are merged
+	// into the message headers.
+	Body *Part
+
+	// raw is the message read by Parse. The missing Message-ID
+	// and Date headers of a parsed message are not generated.
+	raw []byte
 }
 
 // SetSubject creates the Subject header with the specified s value.
@@ -70,50 +134,74 @@ func (b *EmailBuilder) SetSubject(s string) {
 
 // SetPlainCharset creates the plain text Content-Type header
 // with the specified s charset.
+// The UTF-8 encoded plain text body is converted to the charset
+// by the methods setting the body, so it must be called before them.
 func (b *EmailBuilder) SetPlainCharset(s string) {
 	b.PlainHeaders.Set("Content-Type", "text/plain; charset="+s)
 }
 
 // SetHTMLCharset creates the HTML text Content-Type header
 // with the specified s charset.
+// The UTF-8 encoded HTML text body is converted to the charset
+// by the methods setting the body, so it must be called before them.
 func (b *EmailBuilder) SetHTMLCharset(s string) {
 	b.HTMLHeaders.Set("Content-Type", "text/html; charset="+s)
 }
 
 // EncodeBase64Plain encodes s using base64 encoding
 // and writes it to Plain buffer.
+// s is converted from UTF-8 to the charset of the Content-Type header.
+// It limits line length to 76 characters.
 // Plain buffer will be reset to be empty before encoding,
 // but the underlying storage will be retained.
-func (b *EmailBuilder) EncodeBase64Plain(s []byte) {
+func (b *EmailBuilder) EncodeBase64Plain(s []byte) error {
 	b.Plain.Reset()
+	b.PlainReader = nil
 	b.PlainHeaders.Set("Content-Transfer-Encoding", "base64")
-	encoder := base64.NewEncoder(base64.StdEncoding, &b.Plain)
+	s, err := encodeBodyCharset(b.PlainHeaders, s)
+	if err != nil {
+		return err
+	}
+	encoder := newBase64Encoder(&b.Plain)
 	encoder.Write(s)
-	encoder.Close()
+	return encoder.Close()
 }
 
 // EncodeBase64HTML encodes s using base64 encoding
 // and writes it to HTML buffer.
+// s is converted from UTF-8 to the charset of the Content-Type header.
+// It limits line length to 76 characters.
 // HTML buffer will be reset to be empty before encoding,
 // but the underlying storage will be retained.
-func (b *EmailBuilder) EncodeBase64HTML(s []byte) {
+func (b *EmailBuilder) EncodeBase64HTML(s []byte) error {
 	b.HTML.Reset()
+	b.HTMLReader = nil
 	b.HTMLHeaders.Set("Content-Transfer-Encoding", "base64")
-	encoder := base64.NewEncoder(base64.StdEncoding, &b.HTML)
+	s, err := encodeBodyCharset(b.HTMLHeaders, s)
+	if err != nil {
+		return err
+	}
+	encoder := newBase64Encoder(&b.HTML)
 	encoder.Write(s)
-	encoder.Close()
+	return encoder.Close()
 }
 
 // EncodeQuotedPlain encodes s using quoted-printable encoding
 // and writes it to Plain buffer.
+// s is converted from UTF-8 to the charset of the Content-Type header.
 // It limits line length to 76 characters.
 // Plain buffer will be reset to be empty before encoding,
 // but the underlying storage will be retained.
 func (b *EmailBuilder) EncodeQuotedPlain(s []byte) error {
 	b.Plain.Reset()
+	b.PlainReader = nil
 	b.PlainHeaders.Set("Content-Transfer-Encoding", "quoted-printable")
+	s, err := encodeBodyCharset(b.PlainHeaders, s)
+	if err != nil {
+		return err
+	}
 	w := quotedprintable.NewWriter(&b.Plain)
-	_, err := w.Write(s)
+	_, err = w.Write(s)
 	if err != nil {
 		return err
 	}
@@ -122,178 +210,462 @@ func (b *EmailBuilder) EncodeQuotedPlain(s []byte) error {
 
 // EncodeQuotedHTML encodes s using quoted-printable encoding
 // and writes it to HTML buffer.
+// s is converted from UTF-8 to the charset of the Content-Type header.
 // It limits line length to 76 characters.
 // HTML buffer will be reset to be empty before encoding,
 // but the underlying storage will be retained.
 func (b *EmailBuilder) EncodeQuotedHTML(s []byte) error {
 	b.HTML.Reset()
+	b.HTMLReader = nil
 	b.HTMLHeaders.Set("Content-Transfer-Encoding", "quoted-printable")
+	s, err := encodeBodyCharset(b.HTMLHeaders, s)
+	if err != nil {
+		return err
+	}
 	w := quotedprintable.NewWriter(&b.HTML)
-	_, err := w.Write(s)
+	_, err = w.Write(s)
 	if err != nil {
 		return err
 	}
 	return w.Close()
 }
 
-// Write writes a MIME email in wire format.
-func (b *EmailBuilder) Write(w io.Writer) error {
-	text := b.Plain.Len() > 0
-	html := b.HTML.Len() > 0
-	multipart := text && html
-	contentType := b.Headers.Get("Content-Type")
-
-	extraHeaders := make(http.Header)
-	if b.Headers.Get("MIME-Version") == "" {
-		extraHeaders.Set("MIME-Version", "1.0")
+// StreamBase64Plain sets r as the plain text body.
+// It is read and encoded using base64 encoding when the email
+// is written, so the body is never held in memory.
+// The content is converted from UTF-8 to the charset
+// of the Content-Type header while it is read.
+// Plain buffer will be reset to be empty.
+func (b *EmailBuilder) StreamBase64Plain(r io.Reader) error {
+	b.Plain.Reset()
+	b.PlainReader = nil
+	b.PlainHeaders.Set("Content-Transfer-Encoding", "base64")
+	r, err := encodeBodyCharsetReader(b.PlainHeaders, r)
+	if err != nil {
+		return err
 	}
+	b.PlainReader = r
+	return nil
+}
 
-	if b.Headers.Get("Date") == "" {
-		extraHeaders.Set("Date", time.Now().Format(time.RFC1123Z))
+// StreamBase64HTML sets r as the HTML text body.
+// It is read and encoded using base64 encoding when the email
+// is written, so the body is never held in memory.
+// The content is converted from UTF-8 to the charset
+// of the Content-Type header while it is read.
+// HTML buffer will be reset to be empty.
+func (b *EmailBuilder) StreamBase64HTML(r io.Reader) error {
+	b.HTML.Reset()
+	b.HTMLReader = nil
+	b.HTMLHeaders.Set("Content-Transfer-Encoding", "base64")
+	r, err := encodeBodyCharsetReader(b.HTMLHeaders, r)
+	if err != nil {
+		return err
 	}
+	b.HTMLReader = r
+	return nil
+}
 
-	var boundary string
-	if multipart {
-		bo, err := b.BoundaryString()
-		if err != nil {
-			return err
-		}
-		boundary = bo
-
-		if contentType == "" {
-			extraHeaders.Set(
-				"Content-Type",
-				fmt.Sprintf(`multipart/alternative; boundary="%s"`, boundary),
-			)
-		}
+// StreamQuotedPlain sets r as the plain text body.
+// It is read and encoded using quoted-printable encoding when the email
+// is written, so the body is never held in memory.
+// The content is converted from UTF-8 to the charset
+// of the Content-Type header while it is read.
+// Plain buffer will be reset to be empty.
+func (b *EmailBuilder) StreamQuotedPlain(r io.Reader) error {
+	b.Plain.Reset()
+	b.PlainReader = nil
+	b.PlainHeaders.Set("Content-Transfer-Encoding", "quoted-printable")
+	r, err := encodeBodyCharsetReader(b.PlainHeaders, r)
+	if err != nil {
+		return err
 	}
+	b.PlainReader = r
+	return nil
+}
 
-	err := b.Headers.Write(w)
+// StreamQuotedHTML sets r as the HTML text body.
+// It is read and encoded using quoted-printable encoding when the email
+// is written, so the body is never held in memory.
+// The content is converted from UTF-8 to the charset
+// of the Content-Type header while it is read.
+// HTML buffer will be reset to be empty.
+func (b *EmailBuilder) StreamQuotedHTML(r io.Reader) error {
+	b.HTML.Reset()
+	b.HTMLReader = nil
+	b.HTMLHeaders.Set("Content-Transfer-Encoding", "quoted-printable")
+	r, err := encodeBodyCharsetReader(b.HTMLHeaders, r)
 	if err != nil {
 		return err
 	}
-	err = extraHeaders.Write(w)
+	b.HTMLReader = r
+	return nil
+}
+
+// Write writes a MIME email in wire format.
+// The body is the Body part if set, otherwise it is built
+// by the BodyPart method.
+// If the Headers does not contain a Message-ID header
+// a new one will be generated and stored in the Headers,
+// unless the email was read by Parse.
+// Header lines longer than 78 characters are folded.
+// It returns an error if a header line can not be folded
+// to the 998 characters limit.
+// The message is signed by the DKIMSigners if any.
+//
+// The readers of the streamed bodies and attachments are consumed,
+// so an email with streamed content can be written only once.
+// They are encoded directly into w unless the message is signed
+// or encrypted, which requires the message in memory.
+func (b *EmailBuilder) Write(w io.Writer) error {
+	return b.write(w)
+}
+
+// write writes the email in wire format
+// without the header fields associated with the omit keys.
+// The DKIM signatures are computed over the written message.
+func (b *EmailBuilder) write(w io.Writer, omit ...string) error {
+	if len(b.DKIMSigners) == 0 {
+		return b.writeMessage(w, omit...)
+	}
+
+	msg := &bytes.Buffer{}
+	err := b.writeMessage(msg, omit...)
 	if err != nil {
 		return err
 	}
 
-	if multipart {
-		err = b.writeln(w)
+	signatures := make([]string, len(b.DKIMSigners))
+	for i, s := range b.DKIMSigners {
+		sig, err := s.Signature(msg.Bytes())
 		if err != nil {
 			return err
 		}
-
-		err = b.writePartPlain(w, boundary, b.PlainHeaders)
+		signatures[i] = sig
+	}
+	for _, sig := range signatures {
+		_, err = io.WriteString(w, sig)
 		if err != nil {
 			return err
 		}
+	}
+	_, err = w.Write(msg.Bytes())
+	return err
+}
+
+// writeMessage writes the unsigned email in wire format
+// without the header fields associated with the omit keys.
+func (b *EmailBuilder) writeMessage(w io.Writer, omit ...string) error {
+	body, err := b.BodyPart()
+	if err != nil {
+		return err
+	}
+	body, err = b.smimeBody(body)
+	if err != nil {
+		return err
+	}
+	body, err = b.pgpBody(body)
+	if err != nil {
+		return err
+	}
+	err = body.prepare()
+	if err != nil {
+		return err
+	}
 
-		err = b.writePartHTML(w, boundary, b.HTMLHeaders)
+	if b.Headers.Get("Message-ID") == "" && b.raw == nil {
+		_, err := b.GenerateMessageID()
 		if err != nil {
 			return err
 		}
-
-		_, err = w.Write([]byte("--" + boundary + "--"))
-		return err
 	}
 
-	if html {
-		return b.writePartHTML(w, "", b.HTMLHeaders)
+	// The Content-Type of the message applies to the body part
+	// wrapped by S/MIME or PGP/MIME.
+	message := b.Headers
+	if b.SMIMESigner != nil || b.SMIMEEncryptor != nil ||
+		b.PGPSigner != nil || b.PGPEncryptor != nil {
+		message = message.without("Content-Type")
 	}
 
-	return b.writePartPlain(w, "", b.PlainHeaders)
-}
+	headers := message.Clone()
+	for _, key := range omit {
+		headers = headers.without(key)
+	}
+	if headers.Get("MIME-Version") == "" {
+		headers.Set("MIME-Version", "1.0")
+	}
 
-func (b *EmailBuilder) writePartPlain(w io.Writer, boundary string, headers http.Header) error {
-	extraHeaders := make(http.Header)
-	if headers.Get("Content-Type") == "" {
-		extraHeaders.Set("Content-Type", "text/plain; charset=utf-8")
+	if headers.Get("Date") == "" && b.raw == nil {
+		headers.Set("Date", time.Now().Format(time.RFC1123Z))
 	}
 
-	if boundary != "" {
-		_, err := w.Write([]byte("--" + boundary))
-		if err != nil {
-			return err
-		}
-		err = b.writeln(w)
-		if err != nil {
-			return err
+	// The content headers of the body part are merged
+	// into the message headers.
+	for _, f := range body.Headers {
+		if !message.Has(f.Key) {
+			headers.Add(f.Key, f.Value)
 		}
 	}
 
-	err := headers.Write(w)
+	charset := b.HeaderCharset
+	if charset == "" {
+		charset = DefaultHeaderCharset
+	}
+	headers, err = encodeHeaders(charset, headers)
 	if err != nil {
 		return err
 	}
 
-	err = extraHeaders.Write(w)
-	if err != nil {
-		return err
+	order := b.HeaderOrder
+	if order == nil {
+		order = DefaultHeaderOrder
 	}
+	sortHeader(headers, order)
 
-	err = b.writeln(w)
+	err = body.write(w, headers)
 	if err != nil {
 		return err
 	}
 
-	_, err = w.Write(b.Plain.Bytes())
-	if err != nil {
-		return err
+	if !body.IsMultipart() {
+		_, err = w.Write([]byte("\r\n"))
 	}
+	return err
+}
 
-	return b.writeln(w)
+// clone returns a shallow copy of the email with a copy
+// of the message headers, so writing the copy does not store
+// the generated Message-ID and boundary in the email.
+// The bodies, parts and attachments are shared.
+func (b *EmailBuilder) clone() *EmailBuilder {
+	c := *b
+	c.Headers = b.Headers.Clone()
+	return &c
 }
 
-func (b *EmailBuilder) writePartHTML(w io.Writer, boundary string, headers http.Header) error {
-	extraHeaders := make(http.Header)
-	if headers.Get("Content-Type") == "" {
-		extraHeaders.Set("Content-Type", "text/html; charset=utf-8")
+// hasStream reports whether the email has streamed bodies
+// or attachments, which are consumed when the email is written.
+func (b *EmailBuilder) hasStream() bool {
+	if b.PlainReader != nil || b.HTMLReader != nil {
+		return true
 	}
+	for _, a := range b.Attachments {
+		if a.Reader != nil {
+			return true
+		}
+	}
+	for _, a := range b.Inlines {
+		if a.Reader != nil {
+			return true
+		}
+	}
+	if b.Calendar != nil && b.Calendar.hasStream() {
+		return true
+	}
+	return b.Body != nil && b.Body.hasStream()
+}
 
-	if boundary != "" {
-		_, err := w.Write([]byte("--" + boundary))
+// BodyPart returns the root part of the email body.
+// If the Body field is set it will be returned.
+// Otherwise the body is built from the Plain, HTML, Inlines
+// and Attachments fields:
+// if more than one of the plain, the HTML and the Calendar body parts
+// are present they are wrapped in a multipart/alternative part,
+// the plain text body part is generated from the HTML body
+// if GeneratePlain is set,
+// if the email has inline resources the HTML body part is wrapped
+// in a multipart/related part followed by the inline resources,
+// if the email has attachments the body is wrapped in a multipart/mixed
+// part followed by the attachment parts.
+func (b *EmailBuilder) BodyPart() (*Part, error) {
+	if b.Body != nil {
+		return b.Body, nil
+	}
+
+	text := b.Plain.Len() > 0 || b.PlainReader != nil
+	html := b.HTML.Len() > 0 || b.HTMLReader != nil
+
+	var plainPart *Part
+	if text {
+		plainPart = newLeafPart(b.PlainHeaders, "text/plain; charset=utf-8", b.Plain.Bytes())
+		plainPart.Reader = b.PlainReader
+	} else if html && b.GeneratePlain {
+		p, err := b.generatePlainPart()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		err = b.writeln(w)
+		plainPart = p
+		text = true
+	}
+
+	alternatives := 0
+	for _, ok := range []bool{text, html, b.Calendar != nil} {
+		if ok {
+			alternatives++
+		}
+	}
+	alternative := alternatives > 1
+	related := html && len(b.Inlines) > 0
+	mixed := len(b.Attachments) > 0
+
+	if len(b.Inlines) > 0 && !html {
+		return nil, fmt.Errorf("inline resources require an HTML body")
+	}
+
+	var boundary string
+	if alternative || related || mixed {
+		bo, err := b.uniqueBoundaryString()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		boundary = bo
 	}
 
-	err := headers.Write(w)
-	if err != nil {
-		return err
+	var htmlPart *Part
+	if html {
+		htmlPart = newLeafPart(b.HTMLHeaders, "text/html; charset=utf-8", b.HTML.Bytes())
+		htmlPart.Reader = b.HTMLReader
+	}
+	if related {
+		relBoundary := boundary
+		if alternative || mixed {
+			relBoundary = relatedBoundary(boundary)
+		}
+		parts := []*Part{htmlPart}
+		for _, a := range b.Inlines {
+			parts = append(parts, newAttachmentPart(a))
+		}
+		htmlPart = newBoundaryPart("related", relBoundary, parts)
 	}
 
-	err = extraHeaders.Write(w)
-	if err != nil {
-		return err
+	var body *Part
+	switch {
+	case alternative:
+		altBoundary := boundary
+		if mixed {
+			altBoundary = alternativeBoundary(boundary)
+		}
+		var parts []*Part
+		for _, p := range []*Part{plainPart, htmlPart, b.Calendar} {
+			if p != nil {
+				parts = append(parts, p)
+			}
+		}
+		body = newBoundaryPart("alternative", altBoundary, parts)
+	case html:
+		body = htmlPart
+	case text:
+		body = plainPart
+	case b.Calendar != nil:
+		body = b.Calendar
+	case !mixed:
+		body = newLeafPart(b.PlainHeaders, "text/plain; charset=utf-8", nil)
 	}
 
-	err = b.writeln(w)
-	if err != nil {
-		return err
+	if mixed {
+		var parts []*Part
+		if body != nil {
+			parts = append(parts, body)
+		}
+		for _, a := range b.Attachments {
+			parts = append(parts, newAttachmentPart(a))
+		}
+		body = newBoundaryPart("mixed", boundary, parts)
 	}
 
-	_, err = w.Write(b.HTML.Bytes())
-	if err != nil {
-		return err
+	// A custom Content-Type header overrides the generated one.
+	contentType := b.Headers.Get("Content-Type")
+	if contentType != "" {
+		body.Headers.Set("Content-Type", contentType)
+	}
+	return body, nil
+}
+
+// newLeafPart creates a leaf part with a copy of headers and body.
+// If the headers does not contain a Content-Type header
+// contentType will be written before them.
+func newLeafPart(headers Header, contentType string, body []byte) *Part {
+	if headers.Get("Content-Type") == "" {
+		headers = append(Header{{Key: "Content-Type", Value: contentType}}, headers...)
+	} else {
+		headers = headers.Clone()
 	}
+	return &Part{Headers: headers, Body: body}
+}
 
-	return b.writeln(w)
+func newAttachmentPart(a *Attachment) *Part {
+	p := newLeafPart(a.Headers, "application/octet-stream", a.Data.Bytes())
+	p.Reader = a.Reader
+	return p
 }
 
-func (b *EmailBuilder) writeln(w io.Writer) error {
-	_, err := w.Write([]byte("\r\n"))
-	return err
+// newBoundaryPart creates a multipart part with the specified subtype
+// and boundary containing parts.
+func newBoundaryPart(subtype, boundary string, parts []*Part) *Part {
+	p := &Part{Parts: parts}
+	p.Headers.Set(
+		"Content-Type",
+		fmt.Sprintf(`multipart/%s; boundary="%s"`, subtype, boundary),
+	)
+	return p
+}
+
+// maxBase64LineLength is the maximum length of the base64 encoded lines
+// defined in RFC 2045.
+const maxBase64LineLength = 76
+
+// newBase64Encoder returns a base64 encoder writing to w.
+// The encoded lines are wrapped at 76 characters with \r\n.
+// The output does not end with \r\n.
+func newBase64Encoder(w io.Writer) io.WriteCloser {
+	return base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w, max: maxBase64LineLength})
+}
+
+// crlf is the line break written by lineWrapper.
+// A shared slice avoids an allocation for every wrapped line.
+var crlf = []byte("\r\n")
+
+// lineWrapper inserts \r\n into the written data
+// after every max bytes.
+type lineWrapper struct {
+	w   io.Writer
+	max int
+	n   int
+}
+
+func (lw *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if lw.n == lw.max {
+			_, err := lw.w.Write(crlf)
+			if err != nil {
+				return written, err
+			}
+			lw.n = 0
+		}
+
+		chunk := p
+		if len(chunk) > lw.max-lw.n {
+			chunk = chunk[:lw.max-lw.n]
+		}
+		n, err := lw.w.Write(chunk)
+		written += n
+		lw.n += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
 }
 
 // BoundaryString returns the boundary string.
 // If a custom Content-Type header is specified in the Headers
 // the boundary will be parsed from that header value.
 // If a custom Boundary field is specified it will return that value.
-// Otherwise it will return the DefaultBoundary.
+// Otherwise it will return a cryptographically random boundary
+// generated on the first call.
 func (b *EmailBuilder) BoundaryString() (string, error) {
 	contentType := b.Headers.Get("Content-Type")
 	if contentType != "" {
@@ -314,9 +686,89 @@ func (b *EmailBuilder) BoundaryString() (string, error) {
 		return boundary, nil
 	}
 
-	boundary := b.Boundary
-	if boundary == "" {
-		boundary = DefaultBoundary
+	if b.Boundary != "" {
+		return b.Boundary, nil
+	}
+
+	if b.randomBoundary == "" {
+		boundary, err := randomBoundary()
+		if err != nil {
+			return "", err
+		}
+		b.randomBoundary = boundary
+	}
+	return b.randomBoundary, nil
+}
+
+// uniqueBoundaryString returns the boundary string
+// and verifies that it does not occur in any of the encoded parts.
+// A colliding random boundary will be regenerated,
+// a colliding custom boundary results in an error.
+// A custom boundary can not be used with streamed content,
+// because the content is unknown before writing.
+func (b *EmailBuilder) uniqueBoundaryString() (string, error) {
+	for i := 0; i < 10; i++ {
+		boundary, err := b.BoundaryString()
+		if err != nil {
+			return "", err
+		}
+		if boundary != b.randomBoundary && b.hasStream() {
+			return "", fmt.Errorf("custom boundary %q can not be verified in streamed content", boundary)
+		}
+		if !b.containsBoundary(boundary) {
+			return boundary, nil
+		}
+		if boundary != b.randomBoundary {
+			return "", fmt.Errorf("boundary %q occurs in the body parts", boundary)
+		}
+		b.randomBoundary = ""
+	}
+	return "", fmt.Errorf("failed to generate a unique boundary")
+}
+
+// containsBoundary reports whether boundary occurs in any of the
+// encoded parts. The nested boundaries are derived from boundary,
+// so they can not occur in the parts either.
+// The streamed content is not checked, it is unknown before writing.
+func (b *EmailBuilder) containsBoundary(boundary string) bool {
+	bo := []byte(boundary)
+	if bytes.Contains(b.Plain.Bytes(), bo) || bytes.Contains(b.HTML.Bytes(), bo) {
+		return true
+	}
+	if b.Calendar != nil && bytes.Contains(b.Calendar.Body, bo) {
+		return true
 	}
-	return boundary, nil
+	for _, a := range b.Attachments {
+		if bytes.Contains(a.Data.Bytes(), bo) {
+			return true
+		}
+	}
+	for _, a := range b.Inlines {
+		if bytes.Contains(a.Data.Bytes(), bo) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomBoundary returns a cryptographically random boundary.
+func randomBoundary() (string, error) {
+	var buf [16]byte
+	_, err := io.ReadFull(rand.Reader, buf[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// alternativeBoundary returns the boundary of the multipart/alternative
+// part nested in a multipart/mixed email with the specified boundary.
+func alternativeBoundary(boundary string) string {
+	return "alt_" + boundary
+}
+
+// relatedBoundary returns the boundary of the multipart/related
+// part nested in a multipart email with the specified boundary.
+func relatedBoundary(boundary string) string {
+	return "rel_" + boundary
 }
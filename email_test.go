@@ -4,9 +4,14 @@ import (
 	"github.com/szxp/email"
 
 	"bytes"
+	"encoding/base64"
+	"io"
 	"net/http"
+	"net/mail"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +34,7 @@ func TestEmailBuilder(t *testing.T) {
 		HTMLText     string
 
 		ExpectedMimeVersion string
+		ExpectedTo          string
 
 		ExpectedPlainCharset  string
 		ExpectedPlainEncoding string
@@ -53,7 +59,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "",
 			HTMLText:              "",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "base64",
 			ExpectedPlain:         "SGVsbG8gd29ybGQ=",
@@ -75,7 +81,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "",
 			HTMLText:              "",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "quoted-printable",
 			ExpectedPlain:         "H=C3=A9ll=C3=B3 world",
@@ -97,7 +103,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "base64",
 			HTMLText:              "<p>Hello world</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "",
 			ExpectedPlainEncoding: "",
 			ExpectedPlain:         "",
@@ -119,7 +125,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "quoted-printable",
 			HTMLText:              "<p>Hélló world</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "",
 			ExpectedPlainEncoding: "",
 			ExpectedPlain:         "",
@@ -134,14 +140,14 @@ func TestEmailBuilder(t *testing.T) {
 			From:                  "Google Alerts <googlealerts-noreply@example.com>",
 			To:                    []string{"alice@example.com", "Bob <bob@eample.com>"},
 			Subject:               "30+ new jobs for 'software engineer'",
-			Boundary:              "",
+			Boundary:              email.DefaultBoundary,
 			PlainCharset:          "",
 			PlainEncoding:         "base64",
 			PlainText:             "plain text message",
 			HTMLCharset:           "",
 			HTMLEncoding:          "base64",
 			HTMLText:              "<p>HTML message</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "base64",
 			ExpectedPlain:         "cGxhaW4gdGV4dCBtZXNzYWdl",
@@ -155,14 +161,14 @@ func TestEmailBuilder(t *testing.T) {
 			From:                  "Google Alerts <googlealerts-noreply@example.com>",
 			To:                    []string{"alice@example.com", "Bob <bob@eample.com>"},
 			Subject:               "30+ new jobs for 'software engineer'",
-			Boundary:              "",
+			Boundary:              email.DefaultBoundary,
 			PlainCharset:          "",
 			PlainEncoding:         "quoted-printable",
 			PlainText:             "Hélló world",
 			HTMLCharset:           "",
 			HTMLEncoding:          "quoted-printable",
 			HTMLText:              "<p>Hélló world</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "quoted-printable",
 			ExpectedPlain:         "H=C3=A9ll=C3=B3 world",
@@ -180,14 +186,15 @@ func TestEmailBuilder(t *testing.T) {
 				`"Charlie" <charlie@example.com>`,
 			},
 			Subject:               "30+ new jobs for 'software engineer'",
-			Boundary:              "",
+			ExpectedTo:            "alice@example.com, Bob <bob@eample.com>, Charlie <charlie@example.com>",
+			Boundary:              email.DefaultBoundary,
 			PlainCharset:          "iso-8859-1",
 			PlainEncoding:         "base64",
 			PlainText:             "plain text message",
 			HTMLCharset:           "iso-8859-2",
 			HTMLEncoding:          "base64",
 			HTMLText:              "<p>HTML message</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "iso-8859-1",
 			ExpectedPlainEncoding: "base64",
 			ExpectedPlain:         "cGxhaW4gdGV4dCBtZXNzYWdl",
@@ -205,8 +212,9 @@ func TestEmailBuilder(t *testing.T) {
 				"Bob <bob@eample.com>",
 				`"Charlie" <charlie@example.com>`,
 			},
-			Subject:  "30+ new jobs for 'software engineer'",
-			Boundary: "abc123",
+			Subject:    "30+ new jobs for 'software engineer'",
+			ExpectedTo: "alice@example.com, Bob <bob@eample.com>, Charlie <charlie@example.com>",
+			Boundary:   "abc123",
 			Headers: http.Header{
 				"Content-Type": []string{`multipart/alternative; boundary="efg000"`},
 			},
@@ -216,7 +224,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "base64",
 			HTMLText:              "<p>HTML message</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "base64",
 			ExpectedPlain:         "cGxhaW4gdGV4dCBtZXNzYWdl",
@@ -234,6 +242,7 @@ func TestEmailBuilder(t *testing.T) {
 				`"Charlie" <charlie@example.com>`,
 			},
 			Subject:               "30+ new jobs for 'software engineer'",
+			ExpectedTo:            "alice@example.com, Bob <bob@eample.com>, Charlie <charlie@example.com>",
 			Boundary:              "abc123",
 			PlainCharset:          "",
 			PlainEncoding:         "base64",
@@ -241,7 +250,7 @@ func TestEmailBuilder(t *testing.T) {
 			HTMLCharset:           "",
 			HTMLEncoding:          "base64",
 			HTMLText:              "<p>HTML message</p>",
-			ExpectedMimeVersion:   "Mime-Version: 1.0",
+			ExpectedMimeVersion:   "MIME-Version: 1.0",
 			ExpectedPlainCharset:  "utf-8",
 			ExpectedPlainEncoding: "base64",
 			ExpectedPlain:         "cGxhaW4gdGV4dCBtZXNzYWdl",
@@ -255,8 +264,10 @@ func TestEmailBuilder(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.Name, func(t *testing.T) {
 			b := email.NewEmailBuilder()
-			b.SetFrom(c.From)
-			b.SetTo(c.To)
+			err := b.SetFrom(c.From)
+			assert.NoError(t, err)
+			err = b.SetTo(c.To)
+			assert.NoError(t, err)
 			b.SetSubject(c.Subject)
 			b.Boundary = c.Boundary
 
@@ -285,14 +296,18 @@ func TestEmailBuilder(t *testing.T) {
 			}
 
 			w := &bytes.Buffer{}
-			err := b.Write(w)
+			err = b.Write(w)
 			assert.NoError(t, err)
 
 			msg := w.String()
 			assert.Contains(t, msg, c.ExpectedMimeVersion+"\r\n")
 			assert.Contains(t, msg, "Date: ")
 			assert.Contains(t, msg, c.From+"\r\n")
-			assert.Contains(t, msg, strings.Join(c.To, ", ")+"\r\n")
+			expectedTo := c.ExpectedTo
+			if expectedTo == "" {
+				expectedTo = strings.Join(c.To, ", ")
+			}
+			assert.Contains(t, msg, "To: "+expectedTo+"\r\n")
 			assert.Contains(t, msg, "Subject: "+c.Subject+"\r\n")
 
 			if c.ExpectedPlainCharset != "" {
@@ -333,3 +348,263 @@ func TestEmailBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestEmailBuilderRandomBoundary(t *testing.T) {
+	b1 := email.NewEmailBuilder()
+	b1.EncodeQuotedPlain([]byte("plain text message"))
+	b1.EncodeQuotedHTML([]byte("<p>HTML message</p>"))
+
+	w := &bytes.Buffer{}
+	err := b1.Write(w)
+	assert.NoError(t, err)
+
+	boundary1, err := b1.BoundaryString()
+	assert.NoError(t, err)
+	assert.NotEqual(t, email.DefaultBoundary, boundary1)
+	assert.Len(t, boundary1, 32)
+	assert.Contains(t, w.String(), `boundary="`+boundary1+`"`)
+	assert.Contains(t, w.String(), "--"+boundary1+"--")
+
+	boundary, err := b1.BoundaryString()
+	assert.NoError(t, err)
+	assert.Equal(t, boundary1, boundary, "boundary must be stable")
+
+	b2 := email.NewEmailBuilder()
+	boundary2, err := b2.BoundaryString()
+	assert.NoError(t, err)
+	assert.NotEqual(t, boundary1, boundary2)
+}
+
+func TestEmailBuilderBoundaryCollision(t *testing.T) {
+	// Forwarding a message built with the same boundary.
+	b := email.NewEmailBuilder()
+	b.Boundary = email.DefaultBoundary
+	b.EncodeQuotedPlain([]byte("--" + email.DefaultBoundary + "\r\nforwarded"))
+	b.EncodeQuotedHTML([]byte("<p>HTML message</p>"))
+
+	err := b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	// A random boundary never collides.
+	b.Boundary = ""
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	boundary, err := b.BoundaryString()
+	assert.NoError(t, err)
+	assert.NotContains(t, b.Plain.String(), boundary)
+	assert.Contains(t, w.String(), `boundary="`+boundary+`"`)
+}
+
+func TestEmailBuilderCalendarBoundaryCollision(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Boundary = "abc123"
+	b.EncodeQuotedPlain([]byte("Invitation"))
+	e := &email.Event{
+		UID:         "boundary@example.com",
+		Start:       time.Date(2026, time.October, 20, 9, 0, 0, 0, time.UTC),
+		End:         time.Date(2026, time.October, 20, 9, 30, 0, 0, time.UTC),
+		Summary:     "Standup",
+		Description: "--abc123",
+		Organizer:   mail.Address{Address: "alice@example.com"},
+	}
+	err := b.AttachEvent(email.CalendarRequest, e)
+	assert.NoError(t, err)
+	// Only the text/calendar body contains the boundary.
+	b.Attachments = nil
+
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestEmailBuilderStreamCustomBoundary(t *testing.T) {
+	// The streamed content is unknown before writing,
+	// so a custom boundary can not be verified.
+	b := email.NewEmailBuilder()
+	b.Boundary = "abc123"
+	b.StreamQuotedPlain(strings.NewReader("--abc123\r\nstreamed"))
+	b.EncodeQuotedHTML([]byte("<p>HTML message</p>"))
+
+	err := b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	// A random boundary can be used.
+	b = email.NewEmailBuilder()
+	b.StreamQuotedPlain(strings.NewReader("streamed"))
+	b.EncodeQuotedHTML([]byte("<p>HTML message</p>"))
+	err = b.Write(&bytes.Buffer{})
+	assert.NoError(t, err)
+}
+
+func TestEncodeBase64LineLength(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Size          int
+		ExpectedLines int
+	}{
+		{Name: "short", Size: 10, ExpectedLines: 1},
+		{Name: "exactly one line", Size: 57, ExpectedLines: 1},
+		{Name: "one more byte", Size: 58, ExpectedLines: 2},
+		{Name: "long", Size: 1000, ExpectedLines: 18},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			data := bytes.Repeat([]byte("Hélló "), c.Size)[:c.Size]
+
+			b := email.NewEmailBuilder()
+			b.EncodeBase64Plain(data)
+			b.EncodeBase64HTML(data)
+			a := b.Attach("data.bin", data)
+
+			for _, encoded := range []string{b.Plain.String(), b.HTML.String(), a.Data.String()} {
+				lines := strings.Split(encoded, "\r\n")
+				assert.Len(t, lines, c.ExpectedLines)
+				for _, line := range lines {
+					assert.LessOrEqual(t, len(line), 76)
+					assert.NotEmpty(t, line)
+				}
+
+				decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+				assert.NoError(t, err)
+				assert.Equal(t, data, decoded)
+			}
+		})
+	}
+}
+
+func TestEmailBuilderStream(t *testing.T) {
+	plain := []byte(strings.Repeat("Hélló world, this is a long line of the plain text body. ", 20))
+	html := []byte(strings.Repeat("<p>Hélló world</p>\r\n", 20))
+	logo := bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0x00}, 100)
+	pdf := bytes.Repeat([]byte("%PDF-1.4 "), 100)
+
+	cases := []struct {
+		Name   string
+		Encode func(b *email.EmailBuilder)
+		Stream func(b *email.EmailBuilder)
+	}{
+		{
+			Name: "quoted-printable",
+			Encode: func(b *email.EmailBuilder) {
+				b.EncodeQuotedPlain(plain)
+				b.EncodeQuotedHTML(html)
+			},
+			Stream: func(b *email.EmailBuilder) {
+				b.StreamQuotedPlain(bytes.NewReader(plain))
+				b.StreamQuotedHTML(bytes.NewReader(html))
+			},
+		},
+		{
+			Name: "base64",
+			Encode: func(b *email.EmailBuilder) {
+				b.EncodeBase64Plain(plain)
+				b.EncodeBase64HTML(html)
+			},
+			Stream: func(b *email.EmailBuilder) {
+				b.StreamBase64Plain(bytes.NewReader(plain))
+				b.StreamBase64HTML(bytes.NewReader(html))
+			},
+		},
+		{
+			Name: "attachments",
+			Encode: func(b *email.EmailBuilder) {
+				b.EncodeQuotedPlain(plain)
+				b.EncodeQuotedHTML(html)
+				b.Embed("logo", "logo.png", logo)
+				b.Attach("invoice.pdf", pdf)
+			},
+			Stream: func(b *email.EmailBuilder) {
+				b.StreamQuotedPlain(bytes.NewReader(plain))
+				b.StreamQuotedHTML(bytes.NewReader(html))
+				b.EmbedStream("logo", "logo.png", bytes.NewReader(logo))
+				b.AttachStream("invoice.pdf", bytes.NewReader(pdf))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var messages []string
+			for _, build := range []func(b *email.EmailBuilder){c.Encode, c.Stream} {
+				b := email.NewEmailBuilder()
+				b.Headers.Set("Message-ID", "<1@example.com>")
+				b.Headers.Set("Date", "Mon, 02 Jan 2006 15:04:05 +0000")
+				b.SetSubject("Hello")
+				build(b)
+
+				w := &bytes.Buffer{}
+				err := b.Write(w)
+				assert.NoError(t, err)
+				// A custom boundary can not be used with streamed content,
+				// so the random boundaries are compared as the same.
+				boundary, err := b.BoundaryString()
+				assert.NoError(t, err)
+				messages = append(messages, strings.ReplaceAll(w.String(), boundary, "abc123"))
+			}
+			assert.Equal(t, messages[0], messages[1])
+		})
+	}
+}
+
+// patternReader reads n bytes of a repeated pattern.
+type patternReader struct {
+	n int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = byte('a' + i%26)
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+// countingWriter counts the written bytes and discards them.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestEmailBuilderStreamMemory(t *testing.T) {
+	// streamAlloc returns the bytes allocated while writing
+	// an email with a streamed body and attachment of size bytes.
+	streamAlloc := func(size int) uint64 {
+		b := email.NewEmailBuilder()
+		b.SetSubject("Backup")
+		b.StreamQuotedPlain(&patternReader{n: size})
+		b.AttachStream("backup.bin", &patternReader{n: size})
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		w := &countingWriter{}
+		err := b.Write(w)
+		assert.NoError(t, err)
+
+		runtime.ReadMemStats(&after)
+		assert.Greater(t, w.n, size+size*4/3)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	// The allocations do not depend on the size of the content
+	// if it is not buffered. The constant overhead differs
+	// between the environments, e.g. with the race detector.
+	const small, large = 4 << 20, 32 << 20
+	smallAlloc := streamAlloc(small)
+	largeAlloc := streamAlloc(large)
+	growth := int64(largeAlloc) - int64(smallAlloc)
+	assert.Less(t, growth, int64(large-small)/8, "the content must not be buffered")
+}
@@ -0,0 +1,281 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultHeaderCharset is the charset of the encoded-words
+// if the HeaderCharset field is empty.
+const DefaultHeaderCharset = "utf-8"
+
+// addressHeaders are the header fields containing address lists.
+// The non-ASCII display names in them are encoded as RFC 2047 phrases.
+var addressHeaders = map[string]bool{
+	"From":                        true,
+	"Sender":                      true,
+	"Reply-To":                    true,
+	"To":                          true,
+	"Cc":                          true,
+	"Bcc":                         true,
+	"Resent-From":                 true,
+	"Resent-Sender":               true,
+	"Resent-To":                   true,
+	"Resent-Cc":                   true,
+	"Resent-Bcc":                  true,
+	"Disposition-Notification-To": true,
+}
+
+// structuredHeaders are the header fields which must not
+// contain encoded-words.
+var structuredHeaders = map[string]bool{
+	"Date":                      true,
+	"Message-Id":                true,
+	"In-Reply-To":               true,
+	"References":                true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Disposition":       true,
+	"Content-Id":                true,
+	"Return-Path":               true,
+	"Received":                  true,
+}
+
+// encodeHeaders returns a copy of headers in which the non-ASCII
+// values are encoded as RFC 2047 encoded-words.
+// Address headers are parsed and only their display names are encoded.
+func encodeHeaders(charset string, headers Header) (Header, error) {
+	encoded := make(Header, len(headers))
+	for i, f := range headers {
+		key := textproto.CanonicalMIMEHeaderKey(f.Key)
+		v := f.Value
+		var err error
+		// The first encoded-word must fit in the first line
+		// after the key, the others can be folded to new lines.
+		first := maxHeaderLineLength - len(f.Key) - len(": ")
+		switch {
+		case isASCII(v) || structuredHeaders[key]:
+		case addressHeaders[key]:
+			v, err = encodeAddressList(charset, v, first)
+		default:
+			v, err = encodeText(charset, v, first)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s header: %w", f.Key, err)
+		}
+		encoded[i] = HeaderField{Key: f.Key, Value: v}
+	}
+	return encoded, nil
+}
+
+// encodeText encodes the unstructured text s as RFC 2047 encoded-words
+// in the specified charset if s contains non-ASCII characters.
+// The first encoded-word is at most first characters long.
+func encodeText(charset, s string, first int) (string, error) {
+	if isASCII(s) {
+		return s, nil
+	}
+	e, err := encodeCharset(charset, s)
+	if err != nil {
+		return "", err
+	}
+	return encodeWords(wordEncoder(e), charset, s, first, false)
+}
+
+// encodePhrase encodes the display name s as a quoted-string
+// or as RFC 2047 encoded-words if s contains non-ASCII characters.
+// The first encoded-word is at most first characters long.
+func encodePhrase(charset, s string, first int) (string, error) {
+	if isASCII(s) {
+		return quotePhrase(s), nil
+	}
+	e, err := encodeCharset(charset, s)
+	if err != nil {
+		return "", err
+	}
+	return encodeWords(wordEncoder(e), charset, s, first, true)
+}
+
+// maxEncodedWordLength is the maximum length of an encoded-word
+// defined in RFC 2047 section 2.
+const maxEncodedWordLength = 75
+
+// encodeWords encodes s as encoded-words of at most 75 characters
+// in the charset, the first one is at most first characters long
+// to fit in the first header line. mime.WordEncoder splits only
+// UTF-8 text without considering the header key, so the words are
+// split here by the encoded length.
+// The chunks of s are converted separately, so every encoded-word
+// of a stateful charset ends in the initial state as required
+// by RFC 1468. The words of a phrase are encoded by the stricter
+// rules of the display names.
+func encodeWords(enc mime.WordEncoder, charset, s string, first int, phrase bool) (string, error) {
+	if isStatefulCharset(charset) {
+		enc = mime.BEncoding
+	}
+
+	runes := []rune(s)
+	var words []string
+	max := first
+	for len(runes) > 0 {
+		if max > maxEncodedWordLength {
+			max = maxEncodedWordLength
+		}
+		word := ""
+		n := 0
+		for n < len(runes) {
+			e, err := encodeCharset(charset, string(runes[:n+1]))
+			if err != nil {
+				return "", err
+			}
+			w := encodedWord(enc, charset, e, phrase)
+			if len(w) > max && n > 0 {
+				break
+			}
+			word, n = w, n+1
+		}
+		words = append(words, word)
+		runes = runes[n:]
+		max = maxEncodedWordLength
+	}
+	return strings.Join(words, " "), nil
+}
+
+// encodedWord returns the charset encoded text e as a single
+// encoded-word. Unlike mime.WordEncoder it encodes ASCII text too,
+// because the whitespace between an encoded-word and an adjacent
+// unencoded word is not ignored by the decoders.
+// In a phrase the Q encoding leaves only letters, digits and
+// the !*+-/ characters unencoded (RFC 2047 section 5).
+func encodedWord(enc mime.WordEncoder, charset, e string, phrase bool) string {
+	buf := &strings.Builder{}
+	buf.WriteString("=?" + charset + "?")
+	if enc == mime.BEncoding {
+		buf.WriteString("b?")
+		buf.WriteString(base64.StdEncoding.EncodeToString([]byte(e)))
+	} else {
+		buf.WriteString("q?")
+		for i := 0; i < len(e); i++ {
+			c := e[i]
+			switch {
+			case c == ' ':
+				buf.WriteByte('_')
+			case phrase && isPhraseWordChar(c):
+				buf.WriteByte(c)
+			case !phrase && c > ' ' && c <= '~' && c != '=' && c != '?' && c != '_':
+				buf.WriteByte(c)
+			default:
+				fmt.Fprintf(buf, "=%02X", c)
+			}
+		}
+	}
+	buf.WriteString("?=")
+	return buf.String()
+}
+
+// encodeAddressList parses the address list s
+// and encodes the non-ASCII display names in it.
+// The first encoded-word is at most first characters long.
+func encodeAddressList(charset, s string, first int) (string, error) {
+	addrs, err := mail.ParseAddressList(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid address list %q: %w", s, err)
+	}
+
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		spec := formatAddrSpec(a.Address)
+		if a.Name == "" {
+			parts[i] = spec
+			continue
+		}
+		if i > 0 {
+			// The address can be folded to a new line after the comma.
+			first = maxEncodedWordLength
+		}
+		name, err := encodePhrase(charset, a.Name, first)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = name + " <" + spec + ">"
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// wordEncoder returns the encoding resulting in the shorter
+// encoded-words for s.
+func wordEncoder(s string) mime.WordEncoder {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			n++
+		}
+	}
+	// Q encoding triples every non-ASCII byte,
+	// B encoding grows the whole text by a third.
+	if 6*n <= len(s) {
+		return mime.QEncoding
+	}
+	return mime.BEncoding
+}
+
+// isPhraseWordChar reports whether c can be written unencoded
+// in a Q encoded-word within a phrase.
+func isPhraseWordChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!*+-/", c) >= 0
+}
+
+// quotePhrase returns s unchanged if it consists of atoms,
+// otherwise it returns s as a quoted-string.
+// Non-ASCII characters are allowed in atoms as defined in RFC 6532.
+func quotePhrase(s string) string {
+	atoms := s != ""
+	for i := 0; i < len(s); i++ {
+		if s[i] < utf8.RuneSelf && !isAtext(s[i]) && s[i] != ' ' {
+			atoms = false
+			break
+		}
+	}
+	if atoms && !strings.HasPrefix(s, " ") && !strings.HasSuffix(s, " ") && !strings.Contains(s, "  ") {
+		return s
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// isAtext reports whether c is an atext character defined in RFC 5322.
+func isAtext(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
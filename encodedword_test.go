@@ -0,0 +1,244 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+func TestEmailBuilderEncodedWords(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Charset string
+		From    string
+		To      []string
+		Subject string
+
+		ExpectedCharset string
+		ExpectedFrom    *mail.Address
+		ExpectedTo      []*mail.Address
+		ExpectedErr     bool
+	}{
+		{
+			Name:            "ascii",
+			From:            "Google Alerts <googlealerts-noreply@example.com>",
+			To:              []string{"alice@example.com"},
+			Subject:         "Hello",
+			ExpectedCharset: "",
+			ExpectedFrom:    &mail.Address{Name: "Google Alerts", Address: "googlealerts-noreply@example.com"},
+			ExpectedTo:      []*mail.Address{{Address: "alice@example.com"}},
+		},
+		{
+			Name:            "utf-8",
+			From:            "Szakszon Péter <peter@example.com>",
+			To:              []string{"alice@example.com", `"Müller, Jörg" <joerg@example.com>`, `"Doe, John" <john@example.com>`},
+			Subject:         "Számla érkezett",
+			ExpectedCharset: "utf-8",
+			ExpectedFrom:    &mail.Address{Name: "Szakszon Péter", Address: "peter@example.com"},
+			ExpectedTo: []*mail.Address{
+				{Address: "alice@example.com"},
+				{Name: "Müller, Jörg", Address: "joerg@example.com"},
+				{Name: "Doe, John", Address: "john@example.com"},
+			},
+		},
+		{
+			Name:            "iso-8859-1",
+			Charset:         "iso-8859-1",
+			From:            "Jörg <joerg@example.com>",
+			To:              []string{"alice@example.com"},
+			Subject:         "Grüße",
+			ExpectedCharset: "iso-8859-1",
+			ExpectedFrom:    &mail.Address{Name: "Jörg", Address: "joerg@example.com"},
+			ExpectedTo:      []*mail.Address{{Address: "alice@example.com"}},
+		},
+		{
+			Name:            "iso-8859-2",
+			Charset:         "iso-8859-2",
+			From:            "Łukasz <lukasz@example.com>",
+			To:              []string{"alice@example.com"},
+			Subject:         "Zażółć gęślą jaźń",
+			ExpectedCharset: "iso-8859-2",
+			ExpectedFrom:    &mail.Address{Name: "Łukasz", Address: "lukasz@example.com"},
+			ExpectedTo:      []*mail.Address{{Address: "alice@example.com"}},
+		},
+		{
+			Name:            "iso-2022-jp",
+			Charset:         "iso-2022-jp",
+			From:            "山田太郎 <yamada@example.com>",
+			To:              []string{"alice@example.com"},
+			Subject:         "会議のお知らせ: 来週の月曜日の午前十時から第二会議室で定例会議を行います",
+			ExpectedCharset: "iso-2022-jp",
+			ExpectedFrom:    &mail.Address{Name: "山田太郎", Address: "yamada@example.com"},
+			ExpectedTo:      []*mail.Address{{Address: "alice@example.com"}},
+		},
+		{
+			Name:        "not representable",
+			Charset:     "iso-8859-1",
+			From:        "hello@example.com",
+			To:          []string{"alice@example.com"},
+			Subject:     "こんにちは",
+			ExpectedErr: true,
+		},
+		{
+			Name:        "unsupported charset",
+			Charset:     "x-unknown",
+			From:        "hello@example.com",
+			To:          []string{"alice@example.com"},
+			Subject:     "Számla",
+			ExpectedErr: true,
+		},
+		{
+			Name:        "invalid address",
+			From:        "Péter <peter@>",
+			To:          []string{"alice@example.com"},
+			Subject:     "Hello",
+			ExpectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.HeaderCharset = c.Charset
+			b.Headers.Set("From", c.From)
+			b.Headers.Set("To", strings.Join(c.To, ", "))
+			b.SetSubject(c.Subject)
+			b.EncodeQuotedPlain([]byte("Hello"))
+
+			w := &bytes.Buffer{}
+			err := b.Write(w)
+			if c.ExpectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			raw := w.String()
+			assert.True(t, isASCII(raw), "message contains non-ASCII characters: %q", raw)
+			if c.ExpectedCharset != "" {
+				assert.Contains(t, raw, "=?"+c.ExpectedCharset+"?")
+			}
+
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+
+			dec := &mime.WordDecoder{CharsetReader: charsetReader}
+			subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Subject, subject)
+
+			parser := &mail.AddressParser{WordDecoder: dec}
+			from, err := parser.ParseList(msg.Header.Get("From"))
+			assert.NoError(t, err)
+			assert.Equal(t, []*mail.Address{c.ExpectedFrom}, from)
+
+			to, err := parser.ParseList(msg.Header.Get("To"))
+			assert.NoError(t, err)
+			assert.Equal(t, c.ExpectedTo, to)
+		})
+	}
+}
+
+func TestEmailBuilderEncodedWordsLength(t *testing.T) {
+	cases := []struct {
+		Charset string
+		Name    string
+		Subject string
+	}{
+		{"utf-8", "Szakszon Péter", strings.Repeat("Számla érkezett ", 20) + "!"},
+		{"iso-8859-1", "Jörg Müller-Lüdenscheidt von Großhausen zu Köln", strings.Repeat("Grüße aus München ", 20) + "!"},
+		{"iso-8859-2", "Łukasz Żółtowski-Gęślański z Jaźni", strings.Repeat("Zażółć gęślą jaźń ", 30) + "!"},
+		{"iso-2022-jp", "山田太郎", strings.Repeat("会議のお知らせ ", 20) + "!"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Charset, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.HeaderCharset = c.Charset
+			b.Headers.Set("From", c.Name+" <hello@example.com>")
+			b.SetSubject(c.Subject)
+			b.EncodeQuotedPlain([]byte("Hello"))
+
+			w := &bytes.Buffer{}
+			err := b.Write(w)
+			assert.NoError(t, err)
+
+			header := strings.SplitN(w.String(), "\r\n\r\n", 2)[0]
+			for _, line := range strings.Split(header, "\r\n") {
+				assert.LessOrEqual(t, len(line), 78, line)
+			}
+
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+			dec := &mime.WordDecoder{CharsetReader: charsetReader}
+			subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Subject, subject)
+
+			parser := &mail.AddressParser{WordDecoder: dec}
+			from, err := parser.Parse(msg.Header.Get("From"))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Name, from.Name)
+		})
+	}
+}
+
+func TestEmailBuilderEncodedPhrase(t *testing.T) {
+	names := []string{
+		"Zoë & Co {x}",
+		"Zoë #1 'quoted'",
+		"Müller, Jörg",
+		"Zoë_=?",
+	}
+	qWord := regexp.MustCompile(`=\?[^?]+\?q\?([^?]*)\?=`)
+	phraseText := regexp.MustCompile(`^[A-Za-z0-9!*+\-/=_]*$`)
+
+	for _, name := range names {
+		b := email.NewEmailBuilder()
+		err := b.SetAddresses("From", &mail.Address{Name: name, Address: "zoe@example.com"})
+		assert.NoError(t, err)
+		b.EncodeQuotedPlain([]byte("Hello"))
+
+		w := &bytes.Buffer{}
+		err = b.Write(w)
+		assert.NoError(t, err)
+		msg, err := mail.ReadMessage(w)
+		assert.NoError(t, err)
+
+		from := msg.Header.Get("From")
+		for _, m := range qWord.FindAllStringSubmatch(from, -1) {
+			assert.Regexp(t, phraseText, m[1], from)
+		}
+		addr, err := mail.ParseAddress(from)
+		assert.NoError(t, err)
+		assert.Equal(t, name, addr.Name)
+	}
+}
+
+// charsetReader decodes the text read from input
+// in the charset registered by IANA.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
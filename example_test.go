@@ -34,16 +34,16 @@ func ExampleEmailBuilder_textOnly() {
 
 	// This is the result:
 
+	// Return-Path: bounces@example.com
 	// From: hello@example.com
-	// Message-Id: myid
 	// Reply-To: hello@example.com
-	// Return-Path: bounces@example.com
-	// Subject: See you tomorrow
 	// To: alice@example.com, Bob <bob@example.com>
+	// Subject: See you tomorrow
 	// Date: Mon, 02 May 2022 19:51:17 +0200
-	// Mime-Version: 1.0
-	// Content-Transfer-Encoding: base64
+	// Message-ID: myid
+	// MIME-Version: 1.0
 	// Content-Type: text/plain; charset=utf-8
+	// Content-Transfer-Encoding: base64
 	//
 	// U2VlIHlvdSB0b21vcnJvdw==
 }
@@ -75,16 +75,16 @@ func ExampleEmailBuilder_htmlOnly() {
 
 	// This is the result:
 
+	// Return-Path: bounces@example.com
 	// From: hello@example.com
-	// Message-Id: myid
 	// Reply-To: hello@example.com
-	// Return-Path: bounces@example.com
-	// Subject: See you tomorrow
 	// To: alice@example.com, Bob <bob@example.com>
+	// Subject: See you tomorrow
 	// Date: Mon, 02 May 2022 19:51:17 +0200
-	// Mime-Version: 1.0
-	// Content-Transfer-Encoding: quoted-printable
+	// Message-ID: myid
+	// MIME-Version: 1.0
 	// Content-Type: text/html; charset=utf-8
+	// Content-Transfer-Encoding: quoted-printable
 	//
 	// <p>See you tomorrow</p>
 }
@@ -118,25 +118,25 @@ func ExampleEmailBuilder_textAndHTML() {
 
 	// This is the result:
 
+	// Return-Path: bounces@example.com
 	// From: hello@example.com
-	// Message-Id: myid
 	// Reply-To: hello@example.com
-	// Return-Path: bounces@example.com
-	// Subject: See you tomorrow
 	// To: alice@example.com, Bob <bob@example.com>
-	// Content-Type: multipart/alternative; boundary="110000000000863a1705ddeb4f86"
+	// Subject: See you tomorrow
 	// Date: Mon, 02 May 2022 16:38:28 +0200
-	// Mime-Version: 1.0
+	// Message-ID: myid
+	// MIME-Version: 1.0
+	// Content-Type: multipart/alternative; boundary="6f1c2a9e4b7d40f3a8e25c1b9d0f7e34"
 	//
-	// --110000000000863a1705ddeb4f86
-	// Content-Transfer-Encoding: base64
+	// --6f1c2a9e4b7d40f3a8e25c1b9d0f7e34
 	// Content-Type: text/plain; charset=utf-8
+	// Content-Transfer-Encoding: base64
 	//
 	// U2VlIHlvdSB0b21vcnJvdw==
-	// --110000000000863a1705ddeb4f86
-	// Content-Transfer-Encoding: quoted-printable
+	// --6f1c2a9e4b7d40f3a8e25c1b9d0f7e34
 	// Content-Type: text/html; charset=utf-8
+	// Content-Transfer-Encoding: quoted-printable
 	//
 	// <p>See you tomorrow</p>
-	// --110000000000863a1705ddeb4f86--
+	// --6f1c2a9e4b7d40f3a8e25c1b9d0f7e34--
 }
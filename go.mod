@@ -2,7 +2,12 @@ module github.com/szxp/email
 
 go 1.18
 
-require github.com/stretchr/testify v1.7.1
+require (
+	github.com/stretchr/testify v1.7.1
+	github.com/yuin/goldmark v1.6.0
+	golang.org/x/net v0.20.0
+	golang.org/x/text v0.14.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
@@ -0,0 +1,247 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHeaderLineLength is the recommended maximum length
+	// of a header line defined in RFC 5322 without the trailing \r\n.
+	maxHeaderLineLength = 78
+
+	// maxHeaderLineLengthHard is the maximum length
+	// of a header line defined in RFC 5322 without the trailing \r\n.
+	maxHeaderLineLengthHard = 998
+)
+
+var headerNewlineToSpace = strings.NewReplacer("\n", " ", "\r", " ")
+
+// DefaultHeaderOrder is the conventional order of the message header fields.
+var DefaultHeaderOrder = []string{
+	"Return-Path",
+	"From",
+	"Sender",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Bcc",
+	"Subject",
+	"Date",
+	"Message-ID",
+	"In-Reply-To",
+	"References",
+	"MIME-Version",
+}
+
+// HeaderField is a key-value pair of a MIME header.
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// Header stores the key-value pairs of a MIME header.
+// Unlike http.Header it preserves the case of the keys and the order
+// in which the fields were added. Keys are matched case-insensitively.
+// The zero value is an empty header ready to use.
+type Header []HeaderField
+
+// Get returns the first value associated with key.
+// It returns "" if there are no values associated with key.
+func (h Header) Get(key string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Key, key) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values returns all values associated with key.
+func (h Header) Values(key string) []string {
+	var values []string
+	for _, f := range h {
+		if strings.EqualFold(f.Key, key) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Has reports whether the header contains key.
+func (h Header) Has(key string) bool {
+	for _, f := range h {
+		if strings.EqualFold(f.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set replaces the fields associated with key with a single field
+// keeping the position of the first one.
+// If the header does not contain key the field will be appended.
+func (h *Header) Set(key, value string) {
+	for i, f := range *h {
+		if strings.EqualFold(f.Key, key) {
+			(*h)[i] = HeaderField{Key: key, Value: value}
+			*h = append((*h)[:i+1], (*h)[i+1:].without(key)...)
+			return
+		}
+	}
+	h.Add(key, value)
+}
+
+// Add appends the key-value pair to the header.
+func (h *Header) Add(key, value string) {
+	*h = append(*h, HeaderField{Key: key, Value: value})
+}
+
+// Del deletes the fields associated with key.
+func (h *Header) Del(key string) {
+	*h = h.without(key)
+}
+
+// Clone returns a copy of the header.
+func (h Header) Clone() Header {
+	if h == nil {
+		return nil
+	}
+	return append(Header{}, h...)
+}
+
+// Write writes the header fields in wire format in their order.
+// Long header lines are folded to 78 characters if possible.
+// It returns an error if a header line can not be folded
+// to 998 characters.
+func (h Header) Write(w io.Writer) error {
+	for _, f := range h {
+		v := strings.TrimSpace(headerNewlineToSpace.Replace(f.Value))
+		line, err := foldHeaderField(f.Key, v)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, line+"\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// without returns a new header without the fields associated with key.
+func (h Header) without(key string) Header {
+	filtered := make(Header, 0, len(h))
+	for _, f := range h {
+		if !strings.EqualFold(f.Key, key) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// sortHeader sorts the header fields stably by the position
+// of their keys in order. The fields not listed in order
+// keep their relative order after the listed ones.
+func sortHeader(h Header, order []string) {
+	rank := func(key string) int {
+		for i, k := range order {
+			if strings.EqualFold(k, key) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(h, func(i, j int) bool {
+		return rank(h[i].Key) < rank(h[j].Key)
+	})
+}
+
+// foldHeaderField returns the key: value header field
+// folded at whitespaces into lines not longer than 78 characters.
+// The lines of address list headers are preferably broken
+// after the commas separating the addresses.
+// It returns an error if a line can not be folded
+// to 998 characters.
+func foldHeaderField(key, value string) (string, error) {
+	line := key + ": " + value
+	if len(line) <= maxHeaderLineLength {
+		return line, nil
+	}
+
+	commas := addressHeaders[textproto.CanonicalMIMEHeaderKey(key)]
+
+	// The first line must not be broken before the value.
+	min := len(key) + 2
+	buf := &strings.Builder{}
+	for len(line) > maxHeaderLineLength {
+		i := lastFoldIndex(line, min, maxHeaderLineLength, commas)
+		if i == -1 {
+			// No whitespace in the first 78 characters,
+			// break at the first whitespace after them.
+			i = firstFoldIndex(line, maxHeaderLineLength)
+			if i == -1 {
+				break
+			}
+		}
+		if i > maxHeaderLineLengthHard {
+			break
+		}
+
+		buf.WriteString(line[:i])
+		buf.WriteString("\r\n")
+		line = line[i:]
+		min = 1
+	}
+
+	if len(line) > maxHeaderLineLengthHard {
+		return "", fmt.Errorf("%s header line longer than %d characters can not be folded", key, maxHeaderLineLengthHard)
+	}
+	buf.WriteString(line)
+	return buf.String(), nil
+}
+
+// lastFoldIndex returns the index of the last whitespace in line
+// between min and max where the line can be folded.
+// If commas is true a whitespace after a comma is preferred.
+// It returns -1 if there is no such whitespace.
+func lastFoldIndex(line string, min, max int, commas bool) int {
+	last := -1
+	for i := max; i >= min; i-- {
+		if !canFold(line, i) {
+			continue
+		}
+		if !commas || line[i-1] == ',' {
+			return i
+		}
+		if last == -1 {
+			last = i
+		}
+	}
+	return last
+}
+
+// firstFoldIndex returns the index of the first whitespace in line
+// after min where the line can be folded.
+// It returns -1 if there is no such whitespace.
+func firstFoldIndex(line string, min int) int {
+	for i := min; i < len(line); i++ {
+		if canFold(line, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// canFold reports whether line can be folded before the whitespace
+// at index i. Both the folded and the remaining lines must contain
+// non-whitespace characters.
+func canFold(line string, i int) bool {
+	return i > 0 && i < len(line)-1 &&
+		(line[i] == ' ' || line[i] == '\t') &&
+		line[i-1] != ' ' && line[i-1] != '\t' &&
+		strings.TrimLeft(line[i:], " \t") != ""
+}
@@ -0,0 +1,191 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailBuilderHeaderFolding(t *testing.T) {
+	to := make([]string, 200)
+	for i := range to {
+		to[i] = fmt.Sprintf("User %d <user%d@example.com>", i, i)
+	}
+	subject := strings.TrimSpace(strings.Repeat("Számla érkezett a megrendelésről. ", 10))
+	keywords := strings.Repeat("invoice ", 30) + strings.Repeat("x", 500)
+
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	err = b.SetTo(to)
+	assert.NoError(t, err)
+	b.SetSubject(subject)
+	b.Headers.Set("Keywords", keywords)
+	b.EncodeQuotedPlain([]byte("Hello"))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	raw := w.String()
+	head := raw[:strings.Index(raw, "\r\n\r\n")]
+	for _, line := range strings.Split(head, "\r\n") {
+		assert.NotEmpty(t, strings.TrimSpace(line))
+		assert.LessOrEqual(t, len(line), 998, line)
+		if len(line) > 78 {
+			// Only a single word is allowed to exceed the limit.
+			word := strings.TrimSpace(line)
+			if i := strings.Index(word, ": "); i != -1 && !strings.HasPrefix(line, " ") {
+				word = word[i+2:]
+			}
+			assert.NotContains(t, word, " ", line)
+		}
+	}
+
+	for _, line := range strings.Split(head, "\r\n") {
+		if strings.Contains(line, "<user") {
+			assert.True(t, strings.HasSuffix(line, ",") || strings.HasSuffix(line, ">"), line)
+		}
+	}
+
+	msg, err := mail.ReadMessage(w)
+	assert.NoError(t, err)
+
+	list, err := msg.Header.AddressList("To")
+	assert.NoError(t, err)
+	assert.Len(t, list, 200)
+	assert.Equal(t, "User 199", list[199].Name)
+	assert.Equal(t, "user199@example.com", list[199].Address)
+
+	dec := &mime.WordDecoder{}
+	s, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, subject, s)
+
+	assert.Equal(t, keywords, msg.Header.Get("Keywords"))
+}
+
+func TestEmailBuilderHeaderTooLong(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Headers.Set("X-Token", strings.Repeat("x", 999))
+	b.EncodeQuotedPlain([]byte("Hello"))
+
+	err := b.Write(&bytes.Buffer{})
+	assert.ErrorContains(t, err, "X-Token")
+}
+
+func TestHeader(t *testing.T) {
+	h := email.Header{}
+	h.Add("X-Tag", "a")
+	h.Set("Subject", "Hello")
+	h.Add("x-tag", "b")
+	h.Set("To", "alice@example.com")
+
+	assert.Equal(t, "a", h.Get("X-TAG"))
+	assert.Equal(t, []string{"a", "b"}, h.Values("x-Tag"))
+	assert.True(t, h.Has("subject"))
+	assert.False(t, h.Has("Cc"))
+
+	h.Set("x-TAG", "c")
+	assert.Equal(t, email.Header{
+		{Key: "x-TAG", Value: "c"},
+		{Key: "Subject", Value: "Hello"},
+		{Key: "To", Value: "alice@example.com"},
+	}, h)
+
+	clone := h.Clone()
+	h.Del("SUBJECT")
+	assert.Equal(t, email.Header{
+		{Key: "x-TAG", Value: "c"},
+		{Key: "To", Value: "alice@example.com"},
+	}, h)
+	assert.Len(t, clone, 3)
+
+	w := &bytes.Buffer{}
+	err := h.Write(w)
+	assert.NoError(t, err)
+	assert.Equal(t, "x-TAG: c\r\nTo: alice@example.com\r\n", w.String())
+}
+
+func TestEmailBuilderHeaderOrder(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Order    []string
+		Expected string
+	}{
+		{
+			Name:  "default order",
+			Order: nil,
+			Expected: "From: hello@example.com\r\n" +
+				"To: alice@example.com\r\n" +
+				"Subject: See you tomorrow\r\n" +
+				"Date: Mon, 02 May 2022 19:51:17 +0200\r\n" +
+				"Message-ID: <myid@example.com>\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"X-Mailer: szxp/email\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"See you tomorrow\r\n",
+		},
+		{
+			Name:  "insertion order",
+			Order: []string{},
+			Expected: "X-Mailer: szxp/email\r\n" +
+				"Message-ID: <myid@example.com>\r\n" +
+				"Subject: See you tomorrow\r\n" +
+				"To: alice@example.com\r\n" +
+				"From: hello@example.com\r\n" +
+				"Date: Mon, 02 May 2022 19:51:17 +0200\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"See you tomorrow\r\n",
+		},
+		{
+			Name:  "custom order",
+			Order: []string{"Message-ID", "Subject"},
+			Expected: "Message-ID: <myid@example.com>\r\n" +
+				"Subject: See you tomorrow\r\n" +
+				"X-Mailer: szxp/email\r\n" +
+				"To: alice@example.com\r\n" +
+				"From: hello@example.com\r\n" +
+				"Date: Mon, 02 May 2022 19:51:17 +0200\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"See you tomorrow\r\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.HeaderOrder = c.Order
+			b.Headers.Set("X-Mailer", "szxp/email")
+			b.Headers.Set("Message-ID", "<myid@example.com>")
+			b.SetSubject("See you tomorrow")
+			err := b.SetTo([]string{"alice@example.com"})
+			assert.NoError(t, err)
+			err = b.SetFrom("hello@example.com")
+			assert.NoError(t, err)
+			b.Headers.Set("Date", "Mon, 02 May 2022 19:51:17 +0200")
+			b.SetPlainCharset("utf-8")
+			b.EncodeQuotedPlain([]byte("See you tomorrow"))
+
+			w := &bytes.Buffer{}
+			err = b.Write(w)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, w.String())
+		})
+	}
+}
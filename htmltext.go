@@ -0,0 +1,460 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// PlainFromHTML returns a readable plain text version of the HTML text:
+// the paragraphs and headings are separated by empty lines,
+// the h1 and h2 headings are underlined,
+// the list items are marked with bullets or numbers,
+// the cells of the table rows are joined with | characters,
+// the blockquotes are prefixed with > characters and
+// the URLs of the links are listed as numbered footnotes.
+// The scripts, styles and the head of the document are omitted.
+func PlainFromHTML(s []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	w := &textWriter{linkNumbers: map[string]int{}}
+	w.node(doc)
+	w.endBlock()
+
+	if len(w.links) > 0 {
+		w.out.WriteString("\n")
+		for i, link := range w.links {
+			fmt.Fprintf(&w.out, "[%d] %s\n", i+1, link)
+		}
+	}
+	return bytes.TrimRight(w.out.Bytes(), "\n"), nil
+}
+
+// generatePlainPart returns the plain text body part
+// generated from the HTML body.
+func (b *EmailBuilder) generatePlainPart() (*Part, error) {
+	if b.HTMLReader != nil {
+		return nil, fmt.Errorf("plain text body can not be generated from a streamed HTML body")
+	}
+
+	htmlPart := newLeafPart(b.HTMLHeaders, "text/html; charset=utf-8", b.HTML.Bytes())
+	content, err := htmlPart.Content()
+	if err != nil {
+		return nil, err
+	}
+	if charset := bodyCharset(b.HTMLHeaders); charset != "" {
+		enc, err := charsetEncoding(charset)
+		if err != nil {
+			return nil, err
+		}
+		content, err = enc.NewDecoder().Bytes(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	text, err := PlainFromHTML(content)
+	if err != nil {
+		return nil, err
+	}
+	headers := b.PlainHeaders.Clone()
+	body := &bytes.Buffer{}
+	err = encodeBody(body, &headers, text)
+	if err != nil {
+		return nil, err
+	}
+	return newLeafPart(headers, "text/plain; charset=utf-8", body.Bytes()), nil
+}
+
+// textWriter renders the HTML nodes as plain text lines.
+type textWriter struct {
+	out  bytes.Buffer
+	line strings.Builder
+
+	// space reports whether a space precedes the next word.
+	space bool
+
+	// separator is written between the next word and the line,
+	// e.g. between table cells.
+	separator string
+
+	// blank reports whether an empty line precedes the next line.
+	blank bool
+
+	// prefixes are the prefixes of the nested blocks,
+	// e.g. list item markers and blockquote characters.
+	prefixes []*linePrefix
+
+	// pre is the depth of the nested pre elements.
+	pre int
+
+	// lists stores the next item number of the nested lists,
+	// zero for unordered lists.
+	lists []int
+
+	links       []string
+	linkNumbers map[string]int
+}
+
+// linePrefix is written before the lines of a block.
+// The first line can have a different prefix, e.g. a list item marker.
+type linePrefix struct {
+	first string
+	rest  string
+	used  bool
+}
+
+// skippedElements are the elements without readable content.
+var skippedElements = map[string]bool{
+	"head":     true,
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"title":    true,
+}
+
+// blockElements are separated from the surrounding text by empty lines.
+var blockElements = map[string]bool{
+	"address":    true,
+	"article":    true,
+	"aside":      true,
+	"blockquote": true,
+	"dl":         true,
+	"fieldset":   true,
+	"figure":     true,
+	"footer":     true,
+	"form":       true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"header":     true,
+	"main":       true,
+	"nav":        true,
+	"p":          true,
+	"pre":        true,
+	"section":    true,
+	"table":      true,
+}
+
+// lineElements start on a new line.
+var lineElements = map[string]bool{
+	"caption":    true,
+	"dd":         true,
+	"div":        true,
+	"dt":         true,
+	"figcaption": true,
+	"li":         true,
+	"tr":         true,
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	name := n.Data
+	switch {
+	case skippedElements[name]:
+		return
+	case name == "br":
+		if w.line.Len() == 0 {
+			w.blank = w.out.Len() > 0
+		}
+		w.endLine()
+		return
+	case name == "hr":
+		w.endBlock()
+		w.word(strings.Repeat("-", 10))
+		w.endBlock()
+		return
+	case name == "img":
+		w.word(attr(n, "alt"))
+		return
+	case name == "a":
+		w.children(n)
+		w.link(n)
+		return
+	case name == "ul" || name == "ol":
+		w.list(n)
+		return
+	case name == "li":
+		w.listItem(n)
+		return
+	case name == "td" || name == "th":
+		for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+			if c.Type == html.ElementNode {
+				w.separator = " | "
+				break
+			}
+		}
+		w.children(n)
+		return
+	case name == "dd":
+		w.endLine()
+		w.prefixes = append(w.prefixes, &linePrefix{first: "  ", rest: "  "})
+		w.children(n)
+		w.endLine()
+		w.prefixes = w.prefixes[:len(w.prefixes)-1]
+		return
+	case name == "blockquote":
+		w.endBlock()
+		w.prefixes = append(w.prefixes, &linePrefix{first: "> ", rest: "> "})
+		w.children(n)
+		w.endBlock()
+		w.prefixes = w.prefixes[:len(w.prefixes)-1]
+		w.endBlock()
+		return
+	case name == "pre":
+		w.endBlock()
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.endBlock()
+		return
+	case name == "h1" || name == "h2":
+		w.endBlock()
+		w.children(n)
+		underline := "="
+		if name == "h2" {
+			underline = "-"
+		}
+		heading := w.line.String()
+		w.endLine()
+		if heading != "" {
+			w.word(strings.Repeat(underline, utf8.RuneCountInString(heading)))
+		}
+		w.endBlock()
+		return
+	}
+
+	switch {
+	case blockElements[name]:
+		w.endBlock()
+		w.children(n)
+		w.endBlock()
+	case lineElements[name]:
+		w.endLine()
+		w.children(n)
+		w.endLine()
+	default:
+		w.children(n)
+	}
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// list writes the items of an ordered or unordered list.
+// The nested lists are written without empty lines around them.
+func (w *textWriter) list(n *html.Node) {
+	nested := len(w.lists) > 0
+	if nested {
+		w.endLine()
+	} else {
+		w.endBlock()
+	}
+
+	number := 0
+	if n.Data == "ol" {
+		number = 1
+		if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+			number = start
+		}
+	}
+	w.lists = append(w.lists, number)
+	w.children(n)
+	w.lists = w.lists[:len(w.lists)-1]
+
+	if nested {
+		w.endLine()
+	} else {
+		w.endBlock()
+	}
+}
+
+// listItem writes a list item prefixed with a bullet
+// or the number of the item in an ordered list.
+func (w *textWriter) listItem(n *html.Node) {
+	marker := "* "
+	if len(w.lists) > 0 {
+		if number := w.lists[len(w.lists)-1]; number > 0 {
+			marker = strconv.Itoa(number) + ". "
+			w.lists[len(w.lists)-1]++
+		}
+	}
+
+	w.endLine()
+	w.prefixes = append(w.prefixes, &linePrefix{
+		first: marker,
+		rest:  strings.Repeat(" ", len(marker)),
+	})
+	w.children(n)
+	w.endLine()
+	w.prefixes = w.prefixes[:len(w.prefixes)-1]
+}
+
+// link writes the footnote number of the URL of the link
+// after the link text. The URLs repeating the link text,
+// the fragments and the scripts are omitted.
+func (w *textWriter) link(n *html.Node) {
+	href := strings.TrimSpace(attr(n, "href"))
+	text := strings.TrimSpace(textContent(n))
+	switch {
+	case href == "",
+		strings.HasPrefix(href, "#"),
+		strings.HasPrefix(strings.ToLower(href), "javascript:"),
+		href == text,
+		strings.TrimPrefix(href, "mailto:") == text:
+		return
+	}
+
+	number, ok := w.linkNumbers[href]
+	if !ok {
+		w.links = append(w.links, href)
+		number = len(w.links)
+		w.linkNumbers[href] = number
+	}
+	w.space = true
+	w.word("[" + strconv.Itoa(number) + "]")
+}
+
+// text writes the text with the white space collapsed
+// unless it is in a pre element.
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		lines := strings.Split(s, "\n")
+		for i, l := range lines {
+			if i > 0 {
+				if w.line.Len() == 0 {
+					w.emptyLine()
+				}
+				w.endLine()
+			}
+			w.line.WriteString(l)
+		}
+		return
+	}
+
+	if strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+	for i, word := range strings.Fields(s) {
+		if i > 0 {
+			w.space = true
+		}
+		w.word(word)
+	}
+	if strings.TrimRightFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+}
+
+// word appends the word to the current line.
+func (w *textWriter) word(s string) {
+	if s == "" {
+		return
+	}
+	if w.line.Len() > 0 {
+		switch {
+		case w.separator != "":
+			w.line.WriteString(w.separator)
+		case w.space:
+			w.line.WriteString(" ")
+		}
+	}
+	w.line.WriteString(s)
+	w.space = false
+	w.separator = ""
+}
+
+// endLine writes the current line if it is not empty.
+func (w *textWriter) endLine() {
+	w.space = false
+	w.separator = ""
+	if w.line.Len() == 0 {
+		return
+	}
+	if w.blank {
+		w.emptyLine()
+	}
+	w.out.WriteString(w.prefix())
+	w.out.WriteString(w.line.String())
+	w.out.WriteString("\n")
+	w.line.Reset()
+}
+
+// emptyLine writes an empty line. The unused first line prefixes
+// are kept for the next line.
+func (w *textWriter) emptyLine() {
+	buf := &strings.Builder{}
+	for _, p := range w.prefixes {
+		if p.used {
+			buf.WriteString(p.rest)
+		}
+	}
+	w.out.WriteString(strings.TrimRight(buf.String(), " "))
+	w.out.WriteString("\n")
+	w.blank = false
+}
+
+// endBlock writes the current line. The next line
+// is separated from it by an empty line.
+func (w *textWriter) endBlock() {
+	w.endLine()
+	w.blank = w.out.Len() > 0
+}
+
+// prefix returns the prefix of the next line.
+func (w *textWriter) prefix() string {
+	buf := &strings.Builder{}
+	for _, p := range w.prefixes {
+		if p.used {
+			buf.WriteString(p.rest)
+		} else {
+			buf.WriteString(p.first)
+			p.used = true
+		}
+	}
+	return buf.String()
+}
+
+// attr returns the value of the attribute of the element.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns the text in the node and its descendants.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	buf := &strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		buf.WriteString(textContent(c))
+	}
+	return buf.String()
+}
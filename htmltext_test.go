@@ -0,0 +1,127 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainFromHTML(t *testing.T) {
+	cases := []struct {
+		Name     string
+		HTML     string
+		Expected string
+	}{
+		{
+			Name:     "paragraphs",
+			HTML:     "<p>Dear <b>Alice</b>,</p>\n<p>see you\n   tomorrow.<br>Bye</p>",
+			Expected: "Dear Alice,\n\nsee you tomorrow.\nBye",
+		},
+		{
+			Name:     "document",
+			HTML:     "<!DOCTYPE html><html><head><title>Title</title><style>p { color: red; }</style></head><body><p>Hello</p><script>alert(1)</script></body></html>",
+			Expected: "Hello",
+		},
+		{
+			Name:     "headings",
+			HTML:     "<h1>Order shipped</h1><h2>Items</h2><h3>Details</h3><p>Book</p>",
+			Expected: "Order shipped\n=============\n\nItems\n-----\n\nDetails\n\nBook",
+		},
+		{
+			Name:     "links",
+			HTML:     `<p><a href="https://example.com/a">Track</a> your <a href="https://example.com/b">order</a> or <a href="https://example.com/a">here</a>.</p><p><a href="mailto:help@example.com">help@example.com</a> <a href="#top">top</a> <a href="https://example.com">https://example.com</a></p>`,
+			Expected: "Track [1] your order [2] or here [1].\n\nhelp@example.com top https://example.com\n\n[1] https://example.com/a\n[2] https://example.com/b",
+		},
+		{
+			Name:     "lists",
+			HTML:     `<p>Items:</p><ul><li>Book</li><li>Pen<ol start="3"><li>blue</li><li>red</li></ol></li></ul><ol><li>First</li><li>Second</li></ol>`,
+			Expected: "Items:\n\n* Book\n* Pen\n  3. blue\n  4. red\n\n1. First\n2. Second",
+		},
+		{
+			Name:     "table",
+			HTML:     "<table>\n<tr>\n<th>Item</th>\n<th>Price</th>\n</tr>\n<tr><td>Book</td><td>$10</td></tr>\n</table><p>Total: $10</p>",
+			Expected: "Item | Price\nBook | $10\n\nTotal: $10",
+		},
+		{
+			Name:     "layout table",
+			HTML:     `<table><tr><td><img src="logo.png" alt="Example"></td></tr><tr><td><p>Hello</p><p>World</p></td></tr></table>`,
+			Expected: "Example\n\nHello\n\nWorld",
+		},
+		{
+			Name:     "blockquote",
+			HTML:     "<p>Alice wrote:</p><blockquote><p>Hello</p><p>World</p></blockquote><p>Hi</p>",
+			Expected: "Alice wrote:\n\n> Hello\n>\n> World\n\nHi",
+		},
+		{
+			Name:     "pre",
+			HTML:     "<p>Code:</p><pre>if a {\n\n    b()\n}</pre>",
+			Expected: "Code:\n\nif a {\n\n    b()\n}",
+		},
+		{
+			Name:     "entities",
+			HTML:     "<p>Fish &amp; chips &lt;3 &eacute;</p><hr><p>Bye</p>",
+			Expected: "Fish & chips <3 é\n\n----------\n\nBye",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			text, err := email.PlainFromHTML([]byte(c.HTML))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, string(text))
+		})
+	}
+}
+
+func TestEmailBuilderGeneratePlain(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.GeneratePlain = true
+	b.SetHTMLCharset("iso-8859-2")
+	err := b.EncodeQuotedHTML([]byte(`<p>Zażółć <a href="https://example.com">gęślą jaźń</a></p>`))
+	assert.NoError(t, err)
+	b.Embed("logo", "logo.png", []byte("PNG"))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/alternative(text/plain,multipart/related(text/html,image/png))",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+	assert.Equal(t, 0, b.Plain.Len())
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	plain := parsed.Body.Parts[0]
+	assert.Equal(t, "text/plain; charset=utf-8", plain.Headers.Get("Content-Type"))
+	content, err := plain.Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "Zażółć gęślą jaźń [1]\r\n\r\n[1] https://example.com", string(content))
+}
+
+func TestEmailBuilderGeneratePlainStreamed(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.GeneratePlain = true
+	err := b.StreamQuotedHTML(strings.NewReader("<p>Hello</p>"))
+	assert.NoError(t, err)
+
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	// An existing plain text body is not replaced.
+	b = email.NewEmailBuilder()
+	b.GeneratePlain = true
+	b.EncodeQuotedPlain([]byte("Hi"))
+	b.EncodeQuotedHTML([]byte("<p>Hello</p>"))
+	body, err := b.BodyPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", string(body.Parts[0].Body))
+}
@@ -0,0 +1,35 @@
+package email
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown converts GitHub Flavored Markdown to HTML.
+// The raw HTML in the Markdown text is omitted.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// SetMarkdownBody renders the Markdown text s into the HTML body
+// and the plain text body derived from the HTML
+// by the PlainFromHTML function.
+// GitHub Flavored Markdown is supported, the raw HTML in s is omitted.
+// Both bodies are encoded using quoted-printable encoding.
+func (b *EmailBuilder) SetMarkdownBody(s []byte) error {
+	html := &bytes.Buffer{}
+	err := markdown.Convert(s, html)
+	if err != nil {
+		return err
+	}
+	text, err := PlainFromHTML(html.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = b.EncodeQuotedPlain(text)
+	if err != nil {
+		return err
+	}
+	return b.EncodeQuotedHTML(html.Bytes())
+}
@@ -0,0 +1,68 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailBuilderSetMarkdownBody(t *testing.T) {
+	md := "# Disk usage alert\n\n" +
+		"The disk of **db-1** is *almost full*, see the [dashboard](https://example.com/db-1).\n\n" +
+		"- Used: 95%\n" +
+		"- Free: 5 GB\n\n" +
+		"| Host | Usage |\n" +
+		"|------|-------|\n" +
+		"| db-1 | 95%   |\n" +
+		"| db-2 | 40%   |\n\n" +
+		"```\n$ df -h /data\n```\n\n" +
+		"<script>alert(1)</script>\n"
+
+	b := email.NewEmailBuilder()
+	err := b.SetMarkdownBody([]byte(md))
+	assert.NoError(t, err)
+	assert.Equal(t, "quoted-printable", b.PlainHeaders.Get("Content-Transfer-Encoding"))
+	assert.Equal(t, "quoted-printable", b.HTMLHeaders.Get("Content-Transfer-Encoding"))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/alternative(text/plain,text/html)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	plain, err := parsed.Body.Parts[0].Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "Disk usage alert\r\n"+
+		"================\r\n"+
+		"\r\n"+
+		"The disk of db-1 is almost full, see the dashboard [1].\r\n"+
+		"\r\n"+
+		"* Used: 95%\r\n"+
+		"* Free: 5 GB\r\n"+
+		"\r\n"+
+		"Host | Usage\r\n"+
+		"db-1 | 95%\r\n"+
+		"db-2 | 40%\r\n"+
+		"\r\n"+
+		"$ df -h /data\r\n"+
+		"\r\n"+
+		"[1] https://example.com/db-1", string(plain))
+
+	html, err := parsed.Body.Parts[1].Content()
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<h1>Disk usage alert</h1>")
+	assert.Contains(t, string(html), "<strong>db-1</strong>")
+	assert.Contains(t, string(html), `<a href="https://example.com/db-1">dashboard</a>`)
+	assert.Contains(t, string(html), "<table>")
+	assert.NotContains(t, string(html), "<script>")
+}
@@ -0,0 +1,60 @@
+package email
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// MessageID returns the value of the Message-ID header,
+// e.g. the one generated by the Write method.
+func (b *EmailBuilder) MessageID() string {
+	return b.Headers.Get("Message-ID")
+}
+
+// GenerateMessageID generates a globally unique RFC 5322 Message-ID,
+// stores it in the Message-ID header and returns it.
+// The domain of the ID is the MessageIDDomain field. If it is empty
+// the domain of the From address will be used, or the hostname
+// if there is no From address.
+func (b *EmailBuilder) GenerateMessageID() (string, error) {
+	var buf [16]byte
+	_, err := io.ReadFull(rand.Reader, buf[:])
+	if err != nil {
+		return "", err
+	}
+
+	id := fmt.Sprintf("<%d.%s@%s>",
+		time.Now().UnixNano(),
+		hex.EncodeToString(buf[:]),
+		b.messageIDDomain(),
+	)
+	b.Headers.Set("Message-ID", id)
+	return id, nil
+}
+
+// messageIDDomain returns the domain of the generated Message-IDs.
+func (b *EmailBuilder) messageIDDomain() string {
+	if b.MessageIDDomain != "" {
+		return b.MessageIDDomain
+	}
+
+	from, err := mail.ParseAddress(b.Headers.Get("From"))
+	if err == nil {
+		i := strings.LastIndex(from.Address, "@")
+		if i != -1 && i < len(from.Address)-1 {
+			return from.Address[i+1:]
+		}
+	}
+
+	host, err := os.Hostname()
+	if err == nil && host != "" {
+		return host
+	}
+	return "localhost"
+}
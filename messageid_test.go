@@ -0,0 +1,93 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"net/mail"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var messageIDPattern = regexp.MustCompile(`^<[0-9]+\.[0-9a-f]{32}@([^<>@\s]+)>$`)
+
+func TestEmailBuilderMessageID(t *testing.T) {
+	cases := []struct {
+		Name           string
+		From           string
+		Domain         string
+		MessageID      string
+		ExpectedDomain string
+		ExpectedID     string
+	}{
+		{
+			Name:           "from domain",
+			From:           "Hello <hello@mail.example.com>",
+			ExpectedDomain: "mail.example.com",
+		},
+		{
+			Name:           "custom domain",
+			From:           "hello@example.com",
+			Domain:         "id.example.org",
+			ExpectedDomain: "id.example.org",
+		},
+		{
+			Name:       "existing message id",
+			From:       "hello@example.com",
+			MessageID:  "<myid@example.com>",
+			ExpectedID: "<myid@example.com>",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			err := b.SetFrom(c.From)
+			assert.NoError(t, err)
+			b.MessageIDDomain = c.Domain
+			if c.MessageID != "" {
+				b.Headers.Set("Message-ID", c.MessageID)
+			}
+			b.EncodeQuotedPlain([]byte("Hello"))
+
+			w := &bytes.Buffer{}
+			err = b.Write(w)
+			assert.NoError(t, err)
+
+			id := b.MessageID()
+			if c.ExpectedID != "" {
+				assert.Equal(t, c.ExpectedID, id)
+			} else {
+				m := messageIDPattern.FindStringSubmatch(id)
+				if assert.NotNil(t, m, id) {
+					assert.Equal(t, c.ExpectedDomain, m[1])
+				}
+			}
+
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+			assert.Equal(t, id, msg.Header.Get("Message-ID"))
+
+			// The ID is kept for the subsequent writes.
+			w.Reset()
+			err = b.Write(w)
+			assert.NoError(t, err)
+			assert.Contains(t, w.String(), "Message-ID: "+id+"\r\n")
+		})
+	}
+}
+
+func TestEmailBuilderGenerateMessageIDUnique(t *testing.T) {
+	b := email.NewEmailBuilder()
+	ids := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := b.GenerateMessageID()
+		assert.NoError(t, err)
+		assert.Regexp(t, messageIDPattern, id)
+		assert.False(t, ids[id], "duplicate id %s", id)
+		ids[id] = true
+	}
+	assert.Len(t, b.Headers.Values("Message-ID"), 1)
+}
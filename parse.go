@@ -0,0 +1,259 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Parse reads a MIME email in wire format from r and returns
+// an EmailBuilder with the decoded message headers and the body
+// in the Body part tree. The bodies of the parts are kept encoded,
+// use the Content method of the parts to decode them.
+// RFC 2047 encoded-words in the message headers are decoded,
+// so writing the returned EmailBuilder produces an equivalent message:
+// the header fields are written in their original order
+// and no Message-ID or Date header is added.
+func Parse(r io.Reader) (*EmailBuilder, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = normalizeNewlines(data)
+
+	headers, body, err := splitHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewEmailBuilder()
+	b.HeaderOrder = []string{}
+	b.raw = data
+	root := &Part{}
+	for _, f := range headers {
+		if isContentHeader(f.Key) {
+			root.Headers.Add(f.Key, f.Value)
+			continue
+		}
+		b.Headers.Add(f.Key, decodeHeaderValue(f.Key, f.Value))
+	}
+
+	// The trailing \r\n of the message is written by Write.
+	body = bytes.TrimSuffix(body, []byte("\r\n"))
+	err = root.parseBody(body)
+	if err != nil {
+		return nil, err
+	}
+	b.Body = root
+	return b, nil
+}
+
+// Content returns the body of a leaf part decoded according to
+// its Content-Transfer-Encoding header.
+func (p *Part) Content() ([]byte, error) {
+	var r io.Reader = bytes.NewReader(p.Body)
+	switch strings.ToLower(strings.TrimSpace(p.Headers.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "", "7bit", "8bit", "binary":
+	default:
+		return nil, fmt.Errorf("unsupported Content-Transfer-Encoding: %s", p.Headers.Get("Content-Transfer-Encoding"))
+	}
+	return io.ReadAll(r)
+}
+
+// parseBody parses the encoded body of the part.
+// The body of a multipart part is split into the nested parts.
+func (p *Part) parseBody(body []byte) error {
+	if !p.IsMultipart() {
+		p.Body = body
+		return nil
+	}
+
+	boundary := p.Boundary()
+	if boundary == "" {
+		return fmt.Errorf("missing boundary in Content-Type header: %s", p.Headers.Get("Content-Type"))
+	}
+
+	chunks, err := splitMultipart(body, boundary)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		headers, body, err := splitHeader(chunk)
+		if err != nil {
+			return err
+		}
+		c := &Part{Headers: headers}
+		err = c.parseBody(body)
+		if err != nil {
+			return err
+		}
+		p.Parts = append(p.Parts, c)
+	}
+	return nil
+}
+
+// splitHeader parses the header of a MIME entity
+// and returns the header and the remaining body.
+// Folded header lines are unfolded.
+func splitHeader(data []byte) (Header, []byte, error) {
+	var headers Header
+	r := bufio.NewReader(bytes.NewReader(data))
+	n := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		n += len(line)
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(headers) == 0 {
+				return nil, nil, fmt.Errorf("malformed header: continuation line without a header field: %q", line)
+			}
+			headers[len(headers)-1].Value += line
+		} else {
+			i := strings.IndexByte(line, ':')
+			if i <= 0 {
+				return nil, nil, fmt.Errorf("malformed header line: %q", line)
+			}
+			headers = append(headers, HeaderField{
+				Key:   strings.TrimSpace(line[:i]),
+				Value: line[i+1:],
+			})
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	for i := range headers {
+		headers[i].Value = strings.TrimSpace(headers[i].Value)
+	}
+	return headers, data[n:], nil
+}
+
+// splitMultipart splits a multipart body delimited by boundary
+// into the encoded nested parts. The preamble and the epilogue
+// are discarded. A missing closing delimiter is tolerated.
+func splitMultipart(body []byte, boundary string) ([][]byte, error) {
+	delimiter := []byte("--" + boundary)
+	var chunks [][]byte
+	start := -1
+	for i := 0; i < len(body); {
+		j := bytes.Index(body[i:], []byte("\r\n"))
+		end := len(body)
+		if j != -1 {
+			end = i + j
+		}
+		line := body[i:end]
+		next := end + 2
+
+		if bytes.HasPrefix(line, delimiter) {
+			rest := bytes.TrimRight(line[len(delimiter):], " \t")
+			closing := bytes.Equal(rest, []byte("--"))
+			if len(rest) == 0 || closing {
+				if start != -1 {
+					// The \r\n before the delimiter belongs to the delimiter.
+					chunkEnd := i - 2
+					if chunkEnd < start {
+						chunkEnd = start
+					}
+					chunks = append(chunks, body[start:chunkEnd])
+				}
+				if closing {
+					return chunks, nil
+				}
+				start = next
+				if start > len(body) {
+					start = len(body)
+				}
+			}
+		}
+		i = next
+	}
+
+	if start == -1 {
+		return nil, fmt.Errorf("boundary %q not found", boundary)
+	}
+	// Be lenient with truncated messages without a closing delimiter.
+	if start < len(body) {
+		chunks = append(chunks, body[start:])
+	}
+	return chunks, nil
+}
+
+// headerWordDecoder decodes the encoded-words of the headers
+// in any charset supported by charsetEncoding.
+var headerWordDecoder = &mime.WordDecoder{CharsetReader: decodeCharsetReader}
+
+// decodeHeaderValue decodes the RFC 2047 encoded-words
+// in the value of the key header. The address lists are reformatted
+// with unencoded display names. The value is returned unchanged
+// if it can not be decoded.
+func decodeHeaderValue(key, value string) string {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if structuredHeaders[key] || !strings.Contains(value, "=?") {
+		return value
+	}
+
+	if addressHeaders[key] {
+		parser := &mail.AddressParser{WordDecoder: headerWordDecoder}
+		addrs, err := parser.ParseList(value)
+		if err != nil {
+			return value
+		}
+		parts := make([]string, len(addrs))
+		for i, a := range addrs {
+			s, err := formatAddress(a)
+			if err != nil {
+				return value
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	decoded, err := headerWordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// isContentHeader reports whether key is a MIME content header field
+// belonging to the body part of the message.
+func isContentHeader(key string) bool {
+	return len(key) > len("Content-") && strings.EqualFold(key[:len("Content-")], "Content-")
+}
+
+// normalizeNewlines converts the bare \n line endings to \r\n.
+func normalizeNewlines(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) {
+		return data
+	}
+	buf := make([]byte, 0, len(data))
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			buf = append(buf, '\r')
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
@@ -0,0 +1,219 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("Szakszon Péter <peter@example.com>")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com", `"Müller, Jörg" <joerg@example.com>`})
+	assert.NoError(t, err)
+	b.SetSubject("Számla érkezett")
+	b.Headers.Set("Date", "Mon, 02 May 2022 19:51:17 +0200")
+	b.Headers.Set("Message-ID", "<myid@example.com>")
+	b.Headers.Set("X-Campaign", strings.Repeat("spring sale ", 10))
+	b.EncodeQuotedPlain([]byte("Hélló world"))
+	b.EncodeQuotedHTML([]byte(`<p>Hélló world</p><img src="cid:logo">`))
+	b.Embed("logo", "logo.png", []byte("\x89PNG"))
+	b.Attach("számla.pdf", bytes.Repeat([]byte("%PDF-1.4"), 100))
+
+	w1 := &bytes.Buffer{}
+	err = b.Write(w1)
+	assert.NoError(t, err)
+
+	parsed, err := email.Parse(bytes.NewReader(w1.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "Számla érkezett", parsed.Headers.Get("Subject"))
+	assert.Equal(t, "Szakszon Péter <peter@example.com>", parsed.Headers.Get("From"))
+	assert.Equal(t, `alice@example.com, "Müller, Jörg" <joerg@example.com>`, parsed.Headers.Get("To"))
+	assert.Equal(t, "<myid@example.com>", parsed.MessageID())
+
+	w2 := &bytes.Buffer{}
+	err = parsed.Write(w2)
+	assert.NoError(t, err)
+	assert.Equal(t, w1.String(), w2.String())
+}
+
+func TestParseRoundTripForeign(t *testing.T) {
+	raw := strings.Join([]string{
+		"Return-Path: <joerg@example.net>",
+		"Received: from mail.example.net by mx.example.com; 2 May 2022 19:51:18 +0200",
+		"Received: from [10.0.0.2] by mail.example.net; 2 May 2022 19:51:17 +0200",
+		"From: joerg@example.net",
+		"To: alice@example.com",
+		"Subject: Hello",
+		"X-Mailer: Foo 1.0",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain",
+		"",
+		"Hello world",
+		"",
+	}, "\r\n")
+
+	b, err := email.Parse(strings.NewReader(raw))
+	assert.NoError(t, err)
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, w.String())
+	assert.Equal(t, "", b.MessageID())
+}
+
+func TestParse(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: =?iso-8859-1?q?J=F6rg?= <joerg@example.com>",
+		"To: alice@example.com",
+		"Subject: =?utf-8?q?Hello_w?=",
+		" =?utf-8?q?orld?=",
+		"Date: Mon, 02 May 2022 19:51:17 +0200",
+		"Message-ID: <abc@example.com>",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed;",
+		"\tboundary=\"outer\"",
+		"",
+		"This is the preamble.",
+		"--outer",
+		"Content-Type: multipart/alternative; boundary=inner",
+		"",
+		"--inner",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"H=C3=A9ll=C3=B3 world",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>Hello world</p>",
+		"--inner--",
+		"",
+		"--outer",
+		"Content-Type: application/pdf",
+		"Content-Disposition: attachment; filename=invoice.pdf",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0x",
+		"LjQ=",
+		"--outer--",
+		"This is the epilogue.",
+		"",
+	}, "\n")
+
+	b, err := email.Parse(strings.NewReader(raw))
+	assert.NoError(t, err)
+
+	assert.Equal(t, email.Header{
+		{Key: "From", Value: "Jörg <joerg@example.com>"},
+		{Key: "To", Value: "alice@example.com"},
+		{Key: "Subject", Value: "Hello world"},
+		{Key: "Date", Value: "Mon, 02 May 2022 19:51:17 +0200"},
+		{Key: "Message-ID", Value: "<abc@example.com>"},
+		{Key: "MIME-Version", Value: "1.0"},
+	}, b.Headers)
+
+	root := b.Body
+	assert.Equal(t, `multipart/mixed;	boundary="outer"`, root.Headers.Get("Content-Type"))
+	assert.Equal(t, "outer", root.Boundary())
+	if !assert.Len(t, root.Parts, 2) {
+		return
+	}
+
+	alt := root.Parts[0]
+	assert.Equal(t, "inner", alt.Boundary())
+	if !assert.Len(t, alt.Parts, 2) {
+		return
+	}
+
+	plain, err := alt.Parts[0].Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "Hélló world", string(plain))
+
+	html, err := alt.Parts[1].Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Hello world</p>", string(html))
+
+	pdf, err := root.Parts[1].Content()
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", string(pdf))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	again, err := email.Parse(w)
+	assert.NoError(t, err)
+	assert.Equal(t, b.Headers, again.Headers)
+	assert.Equal(t, b.Body, again.Body)
+}
+
+func TestParseSinglePart(t *testing.T) {
+	raw := "Subject: Hello\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"line 1\r\n" +
+		"line 2\r\n"
+
+	b, err := email.Parse(strings.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", b.Headers.Get("Subject"))
+	assert.False(t, b.Body.IsMultipart())
+	assert.Equal(t, "line 1\r\nline 2", string(b.Body.Body))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(w.String(), "Content-Type: text/plain\r\n\r\nline 1\r\nline 2\r\n"))
+}
+
+func TestParseLegacyCharsets(t *testing.T) {
+	raw := "From: =?iso-8859-2?q?=A3ukasz_=AF=F3=B3towski?= <lukasz@example.com>\r\n" +
+		"To: =?windows-1252?q?Ren=E9e?= <renee@example.com>, bob@example.com\r\n" +
+		"Subject: =?windows-1252?Q?Caf=E9?= =?koi8-r?b?8NLJ18XU?=\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+
+	b, err := email.Parse(strings.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, "Łukasz Żółtowski <lukasz@example.com>", b.Headers.Get("From"))
+	assert.Equal(t, "Renée <renee@example.com>, bob@example.com", b.Headers.Get("To"))
+	assert.Equal(t, "CaféПривет", b.Headers.Get("Subject"))
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		Name string
+		Raw  string
+	}{
+		{
+			Name: "malformed header",
+			Raw:  "Subject Hello\r\n\r\nbody",
+		},
+		{
+			Name: "continuation without header",
+			Raw:  " Hello\r\n\r\nbody",
+		},
+		{
+			Name: "missing boundary parameter",
+			Raw:  "Content-Type: multipart/mixed\r\n\r\nbody",
+		},
+		{
+			Name: "boundary not found",
+			Raw:  "Content-Type: multipart/mixed; boundary=abc\r\n\r\nbody",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := email.Parse(strings.NewReader(c.Raw))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// Part is a MIME entity of the email body. It is either a leaf part
+// with an encoded body or a multipart part with nested parts.
+// Parts can be composed into arbitrary structures,
+// e.g. mixed, alternative, related or signed multiparts.
+type Part struct {
+	// Headers stores the key-value pairs of the part.
+	Headers Header
+
+	// Body is the encoded body of a leaf part in wire format without the trailing \r\n.
+	// Not used if the part is a multipart part.
+	Body []byte
+
+	// Reader supplies the unencoded content of a leaf part.
+	// If set, it is used instead of Body: the content is read
+	// and encoded according to the Content-Transfer-Encoding header
+	// on the fly when the part is written, so it can be written only once.
+	Reader io.Reader
+
+	// Parts stores the nested parts of a multipart part.
+	Parts []*Part
+}
+
+// NewPart creates a leaf part with the specified Content-Type.
+func NewPart(contentType string) *Part {
+	p := &Part{}
+	p.Headers.Set("Content-Type", contentType)
+	return p
+}
+
+// NewMultipart creates a multipart part with the specified subtype,
+// e.g. mixed, alternative or related, containing parts.
+// A random boundary will be generated when the part is written.
+func NewMultipart(subtype string, parts ...*Part) *Part {
+	p := &Part{Parts: parts}
+	p.Headers.Set("Content-Type", "multipart/"+subtype)
+	return p
+}
+
+// IsMultipart reports whether the Content-Type of the part is multipart.
+func (p *Part) IsMultipart() bool {
+	mediaType, _, _ := mime.ParseMediaType(p.Headers.Get("Content-Type"))
+	return strings.HasPrefix(mediaType, "multipart/")
+}
+
+// Boundary returns the boundary parameter of the Content-Type header.
+func (p *Part) Boundary() string {
+	_, params, err := mime.ParseMediaType(p.Headers.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// EncodeBase64 encodes s using base64 encoding and stores it in Body.
+// It limits line length to 76 characters.
+func (p *Part) EncodeBase64(s []byte) {
+	buf := &bytes.Buffer{}
+	encoder := newBase64Encoder(buf)
+	encoder.Write(s)
+	encoder.Close()
+	p.Headers.Set("Content-Transfer-Encoding", "base64")
+	p.Body = buf.Bytes()
+}
+
+// EncodeQuoted encodes s using quoted-printable encoding
+// and stores it in Body.
+// It limits line length to 76 characters.
+func (p *Part) EncodeQuoted(s []byte) error {
+	buf := &bytes.Buffer{}
+	w := quotedprintable.NewWriter(buf)
+	_, err := w.Write(s)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	p.Headers.Set("Content-Transfer-Encoding", "quoted-printable")
+	p.Body = buf.Bytes()
+	return nil
+}
+
+// StreamBase64 sets r as the content of the part.
+// It is read and encoded using base64 encoding when the part is written.
+func (p *Part) StreamBase64(r io.Reader) {
+	p.Headers.Set("Content-Transfer-Encoding", "base64")
+	p.Body = nil
+	p.Reader = r
+}
+
+// StreamQuoted sets r as the content of the part.
+// It is read and encoded using quoted-printable encoding
+// when the part is written.
+func (p *Part) StreamQuoted(r io.Reader) {
+	p.Headers.Set("Content-Transfer-Encoding", "quoted-printable")
+	p.Body = nil
+	p.Reader = r
+}
+
+// Write writes the part in wire format: the headers, an empty line
+// and the body without the trailing \r\n.
+// The nested parts of a multipart part are written recursively.
+// Random boundaries are generated for the multipart parts
+// without a boundary parameter.
+// It returns an error if a boundary occurs in the nested parts.
+func (p *Part) Write(w io.Writer) error {
+	err := p.prepare()
+	if err != nil {
+		return err
+	}
+	return p.write(w, p.Headers)
+}
+
+// prepare generates the missing boundaries of the multipart parts
+// and verifies that the boundaries do not occur in the nested parts.
+func (p *Part) prepare() error {
+	if !p.IsMultipart() {
+		return nil
+	}
+
+	boundary := p.Boundary()
+	if boundary == "" {
+		for i := 0; i < 10 && (boundary == "" || p.contains(boundary)); i++ {
+			bo, err := randomBoundary()
+			if err != nil {
+				return err
+			}
+			boundary = bo
+		}
+		p.Headers.Set(
+			"Content-Type",
+			fmt.Sprintf(`%s; boundary="%s"`, p.Headers.Get("Content-Type"), boundary),
+		)
+	}
+	if p.contains(boundary) {
+		return fmt.Errorf("boundary %q occurs in the body parts", boundary)
+	}
+
+	for _, c := range p.Parts {
+		err := c.prepare()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contains reports whether s occurs in the body of the part
+// or any of its nested parts.
+func (p *Part) contains(s string) bool {
+	if bytes.Contains(p.Body, []byte(s)) {
+		return true
+	}
+	for _, c := range p.Parts {
+		if c.contains(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the part with the specified headers.
+func (p *Part) write(w io.Writer, headers Header) error {
+	err := headers.Write(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\r\n")
+	if err != nil {
+		return err
+	}
+
+	if !p.IsMultipart() {
+		if p.Reader != nil {
+			return p.encodeReader(w)
+		}
+		_, err = w.Write(p.Body)
+		return err
+	}
+
+	boundary := p.Boundary()
+	for _, c := range p.Parts {
+		_, err = io.WriteString(w, "--"+boundary+"\r\n")
+		if err != nil {
+			return err
+		}
+		err = c.write(w, c.Headers)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "--"+boundary+"--")
+	return err
+}
+
+// encodeReader reads the content from Reader and writes it to w
+// encoded according to the Content-Transfer-Encoding header.
+func (p *Part) encodeReader(w io.Writer) error {
+	var enc io.WriteCloser
+	switch strings.ToLower(strings.TrimSpace(p.Headers.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		enc = newBase64Encoder(w)
+	case "quoted-printable":
+		enc = quotedprintable.NewWriter(w)
+	default:
+		_, err := io.Copy(w, p.Reader)
+		return err
+	}
+
+	_, err := io.Copy(enc, p.Reader)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// wireFormat returns the part in wire format as signed or encrypted
+// by S/MIME and PGP/MIME. The streamed content is loaded into memory,
+// because the whole content is needed for the signature or
+// the encryption and the part is written again afterwards.
+func (p *Part) wireFormat() ([]byte, error) {
+	err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	err = p.prepare()
+	if err != nil {
+		return nil, err
+	}
+	content := &bytes.Buffer{}
+	err = p.write(content, p.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+// hasStream reports whether the part or any of its nested parts
+// has streamed content.
+func (p *Part) hasStream() bool {
+	if p.Reader != nil {
+		return true
+	}
+	for _, c := range p.Parts {
+		if c.hasStream() {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the content of the streamed parts
+// and stores it encoded in their Body.
+func (p *Part) load() error {
+	if p.Reader != nil {
+		buf := &bytes.Buffer{}
+		err := p.encodeReader(buf)
+		if err != nil {
+			return err
+		}
+		p.Body = buf.Bytes()
+		p.Reader = nil
+	}
+	for _, c := range p.Parts {
+		err := c.load()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
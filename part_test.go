@@ -0,0 +1,196 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailBuilderCustomBody(t *testing.T) {
+	plain := email.NewPart("text/plain; charset=utf-8")
+	err := plain.EncodeQuoted([]byte("Hélló world"))
+	assert.NoError(t, err)
+
+	html := email.NewPart("text/html; charset=utf-8")
+	err = html.EncodeQuoted([]byte("<p>Hélló world</p>"))
+	assert.NoError(t, err)
+
+	report := email.NewPart("application/json")
+	report.Headers.Set("Content-Disposition", "attachment; filename=report.json")
+	report.EncodeBase64([]byte(`{"ok":true}`))
+
+	b := email.NewEmailBuilder()
+	err = b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	b.SetSubject("Report")
+	b.Body = email.NewMultipart("mixed",
+		email.NewMultipart("alternative", plain, html),
+		report,
+	)
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "Report", msg.Header.Get("Subject"))
+	assert.Equal(t,
+		"multipart/mixed(multipart/alternative(text/plain,text/html),application/json)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+
+	// The generated boundaries are stored in the parts.
+	assert.NotEmpty(t, b.Body.Boundary())
+	assert.NotEmpty(t, b.Body.Parts[0].Boundary())
+	assert.NotEqual(t, b.Body.Boundary(), b.Body.Parts[0].Boundary())
+	assert.Contains(t, w.String(), "--"+b.Body.Boundary()+"--")
+
+	msg, err = mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	_, err = r.NextPart()
+	assert.NoError(t, err)
+	p, err := r.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "report.json", p.FileName())
+}
+
+func TestPartWrite(t *testing.T) {
+	p := email.NewMultipart("alternative",
+		&email.Part{
+			Headers: email.Header{{Key: "Content-Type", Value: "text/plain"}},
+			Body:    []byte("plain"),
+		},
+		&email.Part{
+			Headers: email.Header{{Key: "Content-Type", Value: "text/html"}},
+			Body:    []byte("<p>html</p>"),
+		},
+	)
+	p.Headers.Set("Content-Type", `multipart/alternative; boundary="abc123"`)
+
+	w := &bytes.Buffer{}
+	err := p.Write(w)
+	assert.NoError(t, err)
+	assert.Equal(t, "Content-Type: multipart/alternative; boundary=\"abc123\"\r\n"+
+		"\r\n"+
+		"--abc123\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"plain\r\n"+
+		"--abc123\r\n"+
+		"Content-Type: text/html\r\n"+
+		"\r\n"+
+		"<p>html</p>\r\n"+
+		"--abc123--", w.String())
+}
+
+func TestPartStream(t *testing.T) {
+	content := []byte(strings.Repeat("Hélló world ", 20))
+
+	cases := []struct {
+		Name   string
+		Encode func(p *email.Part)
+		Stream func(p *email.Part)
+	}{
+		{
+			Name:   "base64",
+			Encode: func(p *email.Part) { p.EncodeBase64(content) },
+			Stream: func(p *email.Part) { p.StreamBase64(bytes.NewReader(content)) },
+		},
+		{
+			Name:   "quoted-printable",
+			Encode: func(p *email.Part) { p.EncodeQuoted(content) },
+			Stream: func(p *email.Part) { p.StreamQuoted(bytes.NewReader(content)) },
+		},
+		{
+			Name:   "raw",
+			Encode: func(p *email.Part) { p.Body = content },
+			Stream: func(p *email.Part) { p.Reader = bytes.NewReader(content) },
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			encoded := email.NewPart("text/plain; charset=utf-8")
+			c.Encode(encoded)
+			expected := &bytes.Buffer{}
+			err := encoded.Write(expected)
+			assert.NoError(t, err)
+
+			streamed := email.NewPart("text/plain; charset=utf-8")
+			c.Stream(streamed)
+			w := &bytes.Buffer{}
+			err = streamed.Write(w)
+			assert.NoError(t, err)
+			assert.Equal(t, expected.String(), w.String())
+		})
+	}
+}
+
+func TestPartStreamSigned(t *testing.T) {
+	plain := email.NewPart("text/plain; charset=utf-8")
+	plain.StreamQuoted(strings.NewReader("Hélló world"))
+
+	// The streamed content is read into memory to be signed.
+	var signed []byte
+	p, err := email.PGPSign(plain, pgpFunc(func(data []byte) ([]byte, error) {
+		signed = data
+		return []byte("-----BEGIN PGP SIGNATURE-----\n\n-----END PGP SIGNATURE-----\n"), nil
+	}))
+	assert.NoError(t, err)
+	assert.Nil(t, plain.Reader)
+	assert.Contains(t, string(signed), "H=C3=A9ll=C3=B3 world")
+
+	w := &bytes.Buffer{}
+	err = p.Parts[0].Write(w)
+	assert.NoError(t, err)
+	assert.Equal(t, string(signed), w.String())
+}
+
+func TestPartWriteBoundaryCollision(t *testing.T) {
+	p := email.NewMultipart("mixed", &email.Part{
+		Headers: email.Header{{Key: "Content-Type", Value: "text/plain"}},
+		Body:    []byte("--abc123\r\n"),
+	})
+	p.Headers.Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+
+	err := p.Write(io.Discard)
+	assert.Error(t, err)
+}
+
+func TestEmailBuilderBodyPart(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Boundary = "abc123"
+	b.EncodeQuotedPlain([]byte("plain"))
+	b.EncodeQuotedHTML([]byte(`<img src="cid:logo">`))
+	b.Embed("logo", "logo.png", []byte("\x89PNG"))
+	b.Attach("invoice.pdf", []byte("%PDF-1.4"))
+
+	body, err := b.BodyPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", body.Boundary())
+	assert.Len(t, body.Parts, 2)
+
+	alt := body.Parts[0]
+	assert.True(t, alt.IsMultipart())
+	assert.True(t, strings.HasPrefix(alt.Headers.Get("Content-Type"), "multipart/alternative"))
+	assert.Equal(t, "plain", string(alt.Parts[0].Body))
+
+	rel := alt.Parts[1]
+	assert.True(t, strings.HasPrefix(rel.Headers.Get("Content-Type"), "multipart/related"))
+	assert.Equal(t, "<logo>", rel.Parts[1].Headers.Get("Content-ID"))
+
+	assert.Equal(t, "application/pdf", body.Parts[1].Headers.Get("Content-Type"))
+	assert.False(t, body.Parts[1].IsMultipart())
+}
@@ -0,0 +1,128 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+)
+
+// PGPSigner creates detached OpenPGP signatures with the key
+// of the caller, e.g. using an OpenPGP library or gpg.
+type PGPSigner interface {
+	// DetachSign returns the ASCII armored detached signature of data
+	// and the hash algorithm of the signature.
+	DetachSign(data []byte) ([]byte, crypto.Hash, error)
+}
+
+// PGPEncryptor encrypts data for the recipients with OpenPGP
+// using the keys of the caller.
+type PGPEncryptor interface {
+	// Encrypt returns data encrypted into an ASCII armored
+	// OpenPGP message.
+	Encrypt(data []byte) ([]byte, error)
+}
+
+// pgpMicalgs are the micalg parameters of the hash algorithms
+// (RFC 3156 section 5).
+var pgpMicalgs = map[crypto.Hash]string{
+	crypto.MD5:       "pgp-md5",
+	crypto.SHA1:      "pgp-sha1",
+	crypto.RIPEMD160: "pgp-ripemd160",
+	crypto.SHA224:    "pgp-sha224",
+	crypto.SHA256:    "pgp-sha256",
+	crypto.SHA384:    "pgp-sha384",
+	crypto.SHA512:    "pgp-sha512",
+}
+
+// PGPSign returns a multipart/signed part (RFC 3156) containing p
+// and its detached signature created by signer
+// in an application/pgp-signature part.
+// The signature is computed over p in wire format.
+func PGPSign(p *Part, signer PGPSigner) (*Part, error) {
+	content, err := p.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, hash, err := signer.DetachSign(content)
+	if err != nil {
+		return nil, err
+	}
+	micalg, ok := pgpMicalgs[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PGP hash algorithm %v", hash)
+	}
+	sigPart, err := newArmoredPart("application/pgp-signature", "signature.asc", "OpenPGP digital signature", "attachment", sig)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := NewMultipart("signed", p, sigPart)
+	signed.Headers.Set("Content-Type", fmt.Sprintf(`multipart/signed; micalg=%s; protocol="application/pgp-signature"`, micalg))
+	return signed, nil
+}
+
+// PGPEncrypt returns a multipart/encrypted part (RFC 3156)
+// containing p in wire format encrypted by encryptor.
+func PGPEncrypt(p *Part, encryptor PGPEncryptor) (*Part, error) {
+	content, err := p.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptor.Encrypt(content)
+	if err != nil {
+		return nil, err
+	}
+	encryptedPart, err := newArmoredPart("application/octet-stream", "encrypted.asc", "OpenPGP encrypted message", "inline", encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	version := NewPart("application/pgp-encrypted")
+	version.Headers.Set("Content-Description", "PGP/MIME version identification")
+	version.Body = []byte("Version: 1")
+
+	multipart := NewMultipart("encrypted", version, encryptedPart)
+	multipart.Headers.Set("Content-Type", `multipart/encrypted; protocol="application/pgp-encrypted"`)
+	return multipart, nil
+}
+
+// newArmoredPart creates a leaf part with the ASCII armored
+// OpenPGP data as its body.
+func newArmoredPart(contentType, filename, description, disposition string, data []byte) (*Part, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP ")) {
+		return nil, fmt.Errorf("OpenPGP data for %s is not ASCII armored", filename)
+	}
+	p := NewPart(fmt.Sprintf(`%s; name="%s"`, contentType, filename))
+	p.Headers.Set("Content-Description", description)
+	p.Headers.Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+	p.Body = bytes.TrimRight(normalizeNewlines(data), "\r\n")
+	return p, nil
+}
+
+// pgpBody signs and then encrypts the body part
+// with the PGP signer and encryptor of the email if set.
+func (b *EmailBuilder) pgpBody(body *Part) (*Part, error) {
+	if b.PGPSigner == nil && b.PGPEncryptor == nil {
+		return body, nil
+	}
+	if b.SMIMESigner != nil || b.SMIMEEncryptor != nil {
+		return nil, fmt.Errorf("S/MIME and PGP/MIME can not be combined")
+	}
+
+	var err error
+	if b.PGPSigner != nil {
+		body, err = PGPSign(body, b.PGPSigner)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.PGPEncryptor != nil {
+		body, err = PGPEncrypt(body, b.PGPEncryptor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
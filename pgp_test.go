@@ -0,0 +1,203 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"mime"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gpgKeyring is a temporary GnuPG home directory
+// with a key pair of hello@example.com.
+type gpgKeyring struct {
+	home string
+}
+
+// newGPGKeyring creates the keyring.
+// The test is skipped if gpg is not installed.
+func newGPGKeyring(t *testing.T) *gpgKeyring {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		os.RemoveAll(home)
+	})
+
+	k := &gpgKeyring{home: home}
+	_, err = k.run(nil, "--passphrase", "", "--quick-gen-key", "Hello <hello@example.com>", "future-default", "default", "never")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func (k *gpgKeyring) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("gpg", append([]string{"--homedir", k.home, "--batch", "--pinentry-mode", "loopback"}, args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New(err.Error() + ": " + stderr.String())
+	}
+	return out, nil
+}
+
+func (k *gpgKeyring) DetachSign(data []byte) ([]byte, crypto.Hash, error) {
+	sig, err := k.run(data, "--armor", "--detach-sign", "--digest-algo", "SHA512", "--local-user", "hello@example.com")
+	return sig, crypto.SHA512, err
+}
+
+func (k *gpgKeyring) Encrypt(data []byte) ([]byte, error) {
+	return k.run(data, "--armor", "--encrypt", "--trust-model", "always", "--recipient", "hello@example.com")
+}
+
+// verify verifies the detached signature of data.
+func (k *gpgKeyring) verify(t *testing.T, data, sig []byte) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data")
+	sigFile := filepath.Join(dir, "data.asc")
+	assert.NoError(t, os.WriteFile(dataFile, data, 0600))
+	assert.NoError(t, os.WriteFile(sigFile, sig, 0600))
+	_, err := k.run(nil, "--verify", sigFile, dataFile)
+	assert.NoError(t, err)
+}
+
+func newTestPGPEmail(t *testing.T) *email.EmailBuilder {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Hello")
+	b.EncodeQuotedPlain([]byte("Hélló world"))
+	b.EncodeQuotedHTML([]byte("<p>Hélló world</p>"))
+	return b
+}
+
+func TestEmailBuilderPGPSign(t *testing.T) {
+	k := newGPGKeyring(t)
+	b := newTestPGPEmail(t)
+	b.PGPSigner = k
+
+	w := &bytes.Buffer{}
+	err := b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/signed(multipart/alternative(text/plain,text/html),application/pgp-signature)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pgp-signature", params["protocol"])
+	assert.Equal(t, "pgp-sha512", params["micalg"])
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	signed := &bytes.Buffer{}
+	err = parsed.Body.Parts[0].Write(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, string(bodyEntity(t, b)), signed.String())
+
+	sig := parsed.Body.Parts[1]
+	assert.Equal(t, `attachment; filename="signature.asc"`, sig.Headers.Get("Content-Disposition"))
+	k.verify(t, signed.Bytes(), sig.Body)
+}
+
+func TestEmailBuilderPGPEncrypt(t *testing.T) {
+	k := newGPGKeyring(t)
+	b := newTestPGPEmail(t)
+	b.PGPSigner = k
+	b.PGPEncryptor = k
+
+	w := &bytes.Buffer{}
+	err := b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/encrypted(application/pgp-encrypted,application/octet-stream)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+	assert.NotContains(t, w.String(), "text/html")
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "Version: 1", string(parsed.Body.Parts[0].Body))
+
+	decrypted, err := k.run(parsed.Body.Parts[1].Body, "--decrypt")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(decrypted), "Content-Type: multipart/signed; micalg=pgp-sha512;"))
+
+	signed, err := email.Parse(bytes.NewReader(decrypted))
+	assert.NoError(t, err)
+	content := &bytes.Buffer{}
+	err = signed.Body.Parts[0].Write(content)
+	assert.NoError(t, err)
+	assert.Equal(t, string(bodyEntity(t, b)), content.String())
+	k.verify(t, content.Bytes(), signed.Body.Parts[1].Body)
+}
+
+type pgpFunc func(data []byte) ([]byte, error)
+
+func (f pgpFunc) DetachSign(data []byte) ([]byte, crypto.Hash, error) {
+	sig, err := f(data)
+	return sig, crypto.SHA256, err
+}
+
+func (f pgpFunc) Encrypt(data []byte) ([]byte, error) {
+	return f(data)
+}
+
+func TestEmailBuilderPGPErrors(t *testing.T) {
+	binary := pgpFunc(func(data []byte) ([]byte, error) {
+		return []byte{0x89, 0x01}, nil
+	})
+	failing := pgpFunc(func(data []byte) ([]byte, error) {
+		return nil, errors.New("no secret key")
+	})
+
+	b := newTestPGPEmail(t)
+	b.PGPSigner = binary
+	err := b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	b = newTestPGPEmail(t)
+	b.PGPEncryptor = failing
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	b = newTestPGPEmail(t)
+	b.PGPEncryptor = pgpFunc(func(data []byte) ([]byte, error) {
+		return []byte("-----BEGIN PGP MESSAGE-----\n\n-----END PGP MESSAGE-----\n"), nil
+	})
+	b.SMIMESigner = email.NewSMIMESigner(newTestCertificate(t, "hello@example.com", key), key)
+	err = b.Write(&bytes.Buffer{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "can not be combined")
+	}
+}
@@ -0,0 +1,422 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Reply returns a reply to the email from the from address.
+// The reply is addressed to the Reply-To addresses of the email,
+// or to its From address if it has no Reply-To header.
+// Replying to an email sent from the from address it is addressed
+// to the original recipients.
+// The body is text followed by the quoted text of the email.
+// The threading headers are set as defined in RFC 5322 section 3.6.4.
+func (b *EmailBuilder) Reply(from, text string) (*EmailBuilder, error) {
+	return b.reply(from, text, false)
+}
+
+// ReplyAll returns a reply to the email like Reply, but the other
+// recipients of the email are added to the Cc addresses.
+// The from address and the duplicated addresses are omitted.
+func (b *EmailBuilder) ReplyAll(from, text string) (*EmailBuilder, error) {
+	return b.reply(from, text, true)
+}
+
+func (b *EmailBuilder) reply(from, text string, all bool) (*EmailBuilder, error) {
+	r, self, err := b.response(from, "Re: ", "re:")
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := b.addressList("Reply-To")
+	if err != nil {
+		return nil, err
+	}
+	if len(to) == 0 {
+		to, err = b.addressList("From")
+		if err != nil {
+			return nil, err
+		}
+	}
+	ownMessage := containsAddress(to, self.Address)
+	if ownMessage {
+		to, err = b.addressList("To")
+		if err != nil {
+			return nil, err
+		}
+	}
+	to = uniqueAddresses(to, nil)
+	if len(to) == 0 {
+		return nil, fmt.Errorf("missing reply address")
+	}
+	err = r.SetAddresses("To", to...)
+	if err != nil {
+		return nil, err
+	}
+
+	if all {
+		var cc []*mail.Address
+		keys := []string{"To", "Cc"}
+		if ownMessage {
+			keys = []string{"Cc"}
+		}
+		for _, key := range keys {
+			addrs, err := b.addressList(key)
+			if err != nil {
+				return nil, err
+			}
+			cc = append(cc, addrs...)
+		}
+		cc = uniqueAddresses(cc, append([]*mail.Address{self}, to...))
+		err = r.SetAddresses("Cc", cc...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id := b.MessageID(); id != "" {
+		r.Headers.Set("In-Reply-To", id)
+	}
+
+	attribution := b.Headers.Get("From") + " wrote:\n"
+	if date := b.Headers.Get("Date"); date != "" {
+		attribution = "On " + date + ", " + attribution
+	}
+	err = r.setResponseBody(b, text, attribution, true)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Forward returns the email forwarded from the from address
+// with the text followed by the headers and the text of the email.
+// The attachments of the email are forwarded too.
+// The recipients are left to the caller.
+func (b *EmailBuilder) Forward(from, text string) (*EmailBuilder, error) {
+	r, _, err := b.response(from, "Fwd: ", "fwd:", "fw:")
+	if err != nil {
+		return nil, err
+	}
+
+	header := &strings.Builder{}
+	header.WriteString("---------- Forwarded message ---------\n")
+	for _, key := range []string{"From", "Date", "Subject", "To", "Cc"} {
+		if v := b.Headers.Get(key); v != "" {
+			fmt.Fprintf(header, "%s: %s\n", key, v)
+		}
+	}
+	header.WriteString("\n")
+	err = r.setResponseBody(b, text, header.String(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := b.BodyPart()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range body.leafParts() {
+		if isAttachmentPart(p) {
+			r.Attachments = append(r.Attachments, newPartAttachment(p))
+		}
+	}
+	return r, nil
+}
+
+// ForwardAsAttachment returns the email forwarded from the from address
+// with the text body and the email attached as a message/rfc822 part.
+// An email read by Parse is attached as it was received,
+// other emails as rendered by AttachMessage.
+// The recipients are left to the caller.
+func (b *EmailBuilder) ForwardAsAttachment(from, text string) (*EmailBuilder, error) {
+	r, _, err := b.response(from, "Fwd: ", "fwd:", "fw:")
+	if err != nil {
+		return nil, err
+	}
+	err = r.SetPlainBody([]byte(text))
+	if err != nil {
+		return nil, err
+	}
+
+	if b.raw != nil {
+		r.AttachRawMessage(messageFilename(b.Headers.Get("Subject")), b.raw)
+		return r, nil
+	}
+	_, err = r.AttachMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// response returns a new email from the from address
+// with the subject of b prefixed with prefix unless it already
+// starts with one of the existing prefixes. The References header
+// is set to the references of b followed by its Message-ID.
+func (b *EmailBuilder) response(from, prefix string, existing ...string) (*EmailBuilder, *mail.Address, error) {
+	self, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid From address %q: %w", from, err)
+	}
+	r := NewEmailBuilder()
+	err = r.SetAddresses("From", self)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subject := strings.TrimSpace(b.Headers.Get("Subject"))
+	hasPrefix := false
+	for _, p := range existing {
+		if len(subject) >= len(p) && strings.EqualFold(subject[:len(p)], p) {
+			hasPrefix = true
+		}
+	}
+	if !hasPrefix {
+		subject = prefix + subject
+	}
+	r.SetSubject(subject)
+
+	// The parent's References, or its In-Reply-To if it contains
+	// a single identifier, followed by the parent's Message-ID.
+	refs := strings.Fields(b.Headers.Get("References"))
+	if len(refs) == 0 {
+		if parent := strings.Fields(b.Headers.Get("In-Reply-To")); len(parent) == 1 {
+			refs = parent
+		}
+	}
+	if id := b.MessageID(); id != "" {
+		refs = append(refs, id)
+	}
+	if len(refs) > 0 {
+		r.Headers.Set("References", strings.Join(refs, " "))
+	}
+	return r, self, nil
+}
+
+// setResponseBody sets the plain text body to text followed by
+// the intro lines and the plain text of the original email
+// quoted if quote is set. If the original has an HTML body,
+// the HTML body is set likewise with its inline resources.
+func (b *EmailBuilder) setResponseBody(original *EmailBuilder, text, intro string, quote bool) error {
+	body, err := original.BodyPart()
+	if err != nil {
+		return err
+	}
+	plainPart := body.textPart("plain")
+	htmlPart := body.textPart("html")
+
+	var originalText string
+	switch {
+	case plainPart != nil:
+		originalText, err = plainPart.text()
+		if err != nil {
+			return err
+		}
+	case htmlPart != nil:
+		originalHTML, err := htmlPart.text()
+		if err != nil {
+			return err
+		}
+		t, err := PlainFromHTML([]byte(originalHTML))
+		if err != nil {
+			return err
+		}
+		originalText = string(t)
+	}
+	if quote {
+		originalText = quoteText(originalText)
+	}
+
+	plain := strings.TrimRight(text, "\r\n") + "\n\n" + intro + originalText
+	err = b.SetPlainBody([]byte(plain))
+	if err != nil {
+		return err
+	}
+	if htmlPart == nil {
+		return nil
+	}
+
+	originalHTML, err := htmlPart.text()
+	if err != nil {
+		return err
+	}
+	content, err := htmlBodyContent([]byte(originalHTML))
+	if err != nil {
+		return err
+	}
+	buf := &strings.Builder{}
+	buf.WriteString(textToHTML(text))
+	buf.WriteString(textToHTML(intro))
+	if quote {
+		buf.WriteString(`<blockquote type="cite">`)
+		buf.WriteString(content)
+		buf.WriteString("</blockquote>")
+	} else {
+		buf.WriteString(content)
+	}
+	err = b.SetHTMLBody([]byte(buf.String()))
+	if err != nil {
+		return err
+	}
+
+	// The resources referenced by the quoted HTML body.
+	for _, p := range body.leafParts() {
+		if p != htmlPart && !isAttachmentPart(p) && p.Headers.Get("Content-ID") != "" {
+			b.Inlines = append(b.Inlines, newPartAttachment(p))
+		}
+	}
+	return nil
+}
+
+// leafParts returns the leaf parts of the part tree in order.
+func (p *Part) leafParts() []*Part {
+	if !p.IsMultipart() {
+		return []*Part{p}
+	}
+	var parts []*Part
+	for _, c := range p.Parts {
+		parts = append(parts, c.leafParts()...)
+	}
+	return parts
+}
+
+// textPart returns the first text/subtype leaf part
+// which is not an attachment.
+func (p *Part) textPart(subtype string) *Part {
+	for _, c := range p.leafParts() {
+		mediaType, _, err := mime.ParseMediaType(c.Headers.Get("Content-Type"))
+		if err == nil && mediaType == "text/"+subtype && !isAttachmentPart(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns the decoded content of a text part converted to UTF-8.
+func (p *Part) text() (string, error) {
+	content, err := p.Content()
+	if err != nil {
+		return "", err
+	}
+	if charset := bodyCharset(p.Headers); charset != "" {
+		enc, err := charsetEncoding(charset)
+		if err != nil {
+			return "", err
+		}
+		content, err = enc.NewDecoder().Bytes(content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.ReplaceAll(string(content), "\r\n", "\n"), nil
+}
+
+// isAttachmentPart reports whether the disposition type of the part
+// is attachment.
+func isAttachmentPart(p *Part) bool {
+	disposition, _, err := mime.ParseMediaType(p.Headers.Get("Content-Disposition"))
+	return err == nil && disposition == "attachment"
+}
+
+// newPartAttachment returns an attachment with a copy of the headers
+// and the encoded or streamed body of the leaf part.
+func newPartAttachment(p *Part) *Attachment {
+	a := &Attachment{Headers: p.Headers.Clone(), Reader: p.Reader}
+	a.Data.Write(p.Body)
+	return a
+}
+
+// quoteText prefixes the lines of s with > characters.
+func quoteText(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		switch {
+		case l == "":
+			lines[i] = ">"
+		case strings.HasPrefix(l, ">"):
+			lines[i] = ">" + l
+		default:
+			lines[i] = "> " + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textToHTML returns the HTML paragraph of the plain text s.
+func textToHTML(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if s == "" {
+		return ""
+	}
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = template.HTMLEscapeString(l)
+	}
+	return "<p>" + strings.Join(lines, "<br>\n") + "</p>\n"
+}
+
+// htmlBodyContent returns the content of the body element
+// of the HTML document s.
+func htmlBodyContent(s []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	body := findElement(doc, "body")
+	if body == nil {
+		return "", nil
+	}
+	buf := &bytes.Buffer{}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		err = html.Render(buf, c)
+		if err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// findElement returns the first element named name in the node tree.
+func findElement(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if e := findElement(c, name); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// containsAddress reports whether the addresses contain addr
+// compared case-insensitively.
+func containsAddress(addrs []*mail.Address, addr string) bool {
+	for _, a := range addrs {
+		if strings.EqualFold(a.Address, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueAddresses returns the addresses without the duplicates
+// and the excluded addresses compared case-insensitively.
+func uniqueAddresses(addrs, exclude []*mail.Address) []*mail.Address {
+	var unique []*mail.Address
+	for _, a := range addrs {
+		if containsAddress(exclude, a.Address) || containsAddress(unique, a.Address) {
+			continue
+		}
+		unique = append(unique, a)
+	}
+	return unique
+}
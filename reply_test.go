@@ -0,0 +1,295 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestOriginal returns a parsed email with plain, HTML,
+// an inline image and an attachment.
+func newTestOriginal(t *testing.T) *email.EmailBuilder {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("Alice <alice@example.com>")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"bob@example.com", "Carol <carol@example.com>"})
+	assert.NoError(t, err)
+	err = b.SetCc([]string{"dave@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Lunch")
+	b.Headers.Set("Date", "Mon, 02 May 2022 19:51:17 +0200")
+	b.Headers.Set("Message-ID", "<lunch@example.com>")
+	b.Headers.Set("References", "<a@example.com> <b@example.com>")
+	err = b.SetPlainBody([]byte("Pizza at noon?\n> quoted before"))
+	assert.NoError(t, err)
+	err = b.SetHTMLBody([]byte(`<html><head><title>x</title></head><body><p>Pizza at <b>noon</b>?</p><img src="cid:logo"></body></html>`))
+	assert.NoError(t, err)
+	b.Embed("logo", "logo.png", []byte("\x89PNG"))
+	b.Attach("menu.pdf", []byte("%PDF-1.4"))
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	return parsed
+}
+
+// partContents returns the decoded contents of the leaf parts
+// of the written email by media type.
+func partContents(t *testing.T, b *email.EmailBuilder) map[string][]string {
+	w := &bytes.Buffer{}
+	err := b.Write(w)
+	assert.NoError(t, err)
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+
+	contents := map[string][]string{}
+	var walk func(p *email.Part)
+	walk = func(p *email.Part) {
+		if p.IsMultipart() {
+			for _, c := range p.Parts {
+				walk(c)
+			}
+			return
+		}
+		mediaType := strings.SplitN(p.Headers.Get("Content-Type"), ";", 2)[0]
+		content, err := p.Content()
+		assert.NoError(t, err)
+		contents[mediaType] = append(contents[mediaType], strings.ReplaceAll(string(content), "\r\n", "\n"))
+	}
+	walk(parsed.Body)
+	return contents
+}
+
+func TestEmailBuilderReplyRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		from    string
+		all     bool
+		wantTo  string
+		wantCc  string
+	}{
+		{
+			name:    "reply",
+			headers: map[string]string{"From": "Alice <alice@example.com>", "To": "bob@example.com", "Cc": "carol@example.com"},
+			from:    "bob@example.com",
+			wantTo:  "Alice <alice@example.com>",
+		},
+		{
+			name:    "reply-to",
+			headers: map[string]string{"From": "alice@example.com", "Reply-To": "list@example.com", "To": "bob@example.com"},
+			from:    "bob@example.com",
+			wantTo:  "list@example.com",
+		},
+		{
+			name:    "reply all",
+			headers: map[string]string{"From": "alice@example.com", "To": "BOB@example.com, carol@example.com", "Cc": "Alice <ALICE@example.com>, dave@example.com, carol@example.com"},
+			from:    "Bob <bob@example.com>",
+			all:     true,
+			wantTo:  "alice@example.com",
+			wantCc:  "carol@example.com, dave@example.com",
+		},
+		{
+			name:    "reply all to own message",
+			headers: map[string]string{"From": "bob@example.com", "To": "alice@example.com, carol@example.com", "Cc": "dave@example.com, bob@example.com"},
+			from:    "bob@example.com",
+			all:     true,
+			wantTo:  "alice@example.com, carol@example.com",
+			wantCc:  "dave@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			for k, v := range tt.headers {
+				b.Headers.Set(k, v)
+			}
+			b.SetPlainBody([]byte("Hello"))
+
+			reply, err := b.Reply(tt.from, "Hi")
+			if tt.all {
+				reply, err = b.ReplyAll(tt.from, "Hi")
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTo, reply.Headers.Get("To"))
+			assert.Equal(t, tt.wantCc, reply.Headers.Get("Cc"))
+		})
+	}
+}
+
+func TestEmailBuilderReplyErrors(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.SetPlainBody([]byte("Hello"))
+	_, err := b.Reply("bob@example.com", "Hi")
+	assert.Error(t, err)
+
+	b.Headers.Set("From", "alice@example.com")
+	_, err = b.Reply("not an address", "Hi")
+	assert.Error(t, err)
+}
+
+func TestEmailBuilderReplySubject(t *testing.T) {
+	tests := []struct {
+		subject     string
+		wantReply   string
+		wantForward string
+	}{
+		{"Lunch", "Re: Lunch", "Fwd: Lunch"},
+		{"RE: Lunch", "RE: Lunch", "Fwd: RE: Lunch"},
+		{"Fw: Lunch", "Re: Fw: Lunch", "Fw: Lunch"},
+		{"", "Re: ", "Fwd: "},
+	}
+
+	for _, tt := range tests {
+		b := email.NewEmailBuilder()
+		b.Headers.Set("From", "alice@example.com")
+		b.SetSubject(tt.subject)
+		b.SetPlainBody([]byte("Hello"))
+
+		reply, err := b.Reply("bob@example.com", "Hi")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.wantReply, reply.Headers.Get("Subject"))
+
+		forward, err := b.Forward("bob@example.com", "FYI")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.wantForward, forward.Headers.Get("Subject"))
+	}
+}
+
+func TestEmailBuilderReply(t *testing.T) {
+	original := newTestOriginal(t)
+	reply, err := original.Reply("bob@example.com", "Sure!\n<3")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "bob@example.com", reply.Headers.Get("From"))
+	assert.Equal(t, "Alice <alice@example.com>", reply.Headers.Get("To"))
+	assert.Equal(t, "<lunch@example.com>", reply.Headers.Get("In-Reply-To"))
+	assert.Equal(t, "<a@example.com> <b@example.com> <lunch@example.com>", reply.Headers.Get("References"))
+	assert.Equal(t, "Re: Lunch", reply.Headers.Get("Subject"))
+	assert.Len(t, reply.Attachments, 0)
+
+	contents := partContents(t, reply)
+	assert.Equal(t, []string{strings.Join([]string{
+		"Sure!",
+		"<3",
+		"",
+		"On Mon, 02 May 2022 19:51:17 +0200, Alice <alice@example.com> wrote:",
+		"> Pizza at noon?",
+		">> quoted before",
+	}, "\n")}, contents["text/plain"])
+	assert.Equal(t, []string{
+		"<p>Sure!<br>\n&lt;3</p>\n" +
+			"<p>On Mon, 02 May 2022 19:51:17 +0200, Alice &lt;alice@example.com&gt; wrote:</p>\n" +
+			`<blockquote type="cite"><p>Pizza at <b>noon</b>?</p><img src="cid:logo"/></blockquote>`,
+	}, contents["text/html"])
+	assert.Equal(t, []string{"\x89PNG"}, contents["image/png"])
+}
+
+func TestEmailBuilderReplyThreading(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Headers.Set("From", "alice@example.com")
+	b.Headers.Set("Message-ID", "<2@example.com>")
+	b.Headers.Set("In-Reply-To", "<1@example.com>")
+	b.SetPlainBody([]byte("Hello"))
+
+	reply, err := b.Reply("bob@example.com", "Hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "<2@example.com>", reply.Headers.Get("In-Reply-To"))
+	assert.Equal(t, "<1@example.com> <2@example.com>", reply.Headers.Get("References"))
+
+	b.Headers.Del("Message-ID")
+	reply, err = b.Reply("bob@example.com", "Hi")
+	assert.NoError(t, err)
+	assert.False(t, reply.Headers.Has("In-Reply-To"))
+	assert.Equal(t, "<1@example.com>", reply.Headers.Get("References"))
+}
+
+func TestEmailBuilderReplyHTMLOnly(t *testing.T) {
+	b := email.NewEmailBuilder()
+	b.Headers.Set("From", "alice@example.com")
+	b.SetHTMLBody([]byte("<p>Pizza at <b>noon</b>?</p>"))
+
+	reply, err := b.Reply("bob@example.com", "Sure!")
+	assert.NoError(t, err)
+	contents := partContents(t, reply)
+	assert.Equal(t, []string{"Sure!\n\nalice@example.com wrote:\n> Pizza at noon?"}, contents["text/plain"])
+	assert.Len(t, contents["text/html"], 1)
+}
+
+func TestEmailBuilderForward(t *testing.T) {
+	original := newTestOriginal(t)
+	forward, err := original.Forward("Bob <bob@example.com>", "FYI")
+	assert.NoError(t, err)
+	err = forward.SetTo([]string{"erin@example.com"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Fwd: Lunch", forward.Headers.Get("Subject"))
+	assert.Equal(t, "<a@example.com> <b@example.com> <lunch@example.com>", forward.Headers.Get("References"))
+	assert.False(t, forward.Headers.Has("In-Reply-To"))
+
+	contents := partContents(t, forward)
+	assert.Equal(t, []string{strings.Join([]string{
+		"FYI",
+		"",
+		"---------- Forwarded message ---------",
+		"From: Alice <alice@example.com>",
+		"Date: Mon, 02 May 2022 19:51:17 +0200",
+		"Subject: Lunch",
+		"To: bob@example.com, Carol <carol@example.com>",
+		"Cc: dave@example.com",
+		"",
+		"Pizza at noon?",
+		"> quoted before",
+	}, "\n")}, contents["text/plain"])
+	assert.Contains(t, contents["text/html"][0], "<p>Pizza at <b>noon</b>?</p>")
+	assert.NotContains(t, contents["text/html"][0], "blockquote")
+	assert.Equal(t, []string{"\x89PNG"}, contents["image/png"])
+	assert.Equal(t, []string{"%PDF-1.4"}, contents["application/pdf"])
+}
+
+func TestEmailBuilderForwardAsAttachment(t *testing.T) {
+	raw := strings.Join([]string{
+		"Received: from mail.example.net by mx.example.com; 2 May 2022 19:51:18 +0200",
+		"From: =?utf-8?q?J=C3=B6rg?= <joerg@example.net>",
+		"To: bob@example.com",
+		"Subject: Lunch",
+		"Content-Type: text/plain",
+		"",
+		"Pizza at noon?",
+		"",
+	}, "\r\n")
+	original, err := email.Parse(strings.NewReader(raw))
+	assert.NoError(t, err)
+
+	forward, err := original.ForwardAsAttachment("bob@example.com", "See the attached message.")
+	assert.NoError(t, err)
+	err = forward.SetTo([]string{"erin@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Fwd: Lunch", forward.Headers.Get("Subject"))
+	assert.Equal(t, "", original.MessageID(), "the original must not be modified")
+
+	w := &bytes.Buffer{}
+	err = forward.Write(w)
+	assert.NoError(t, err)
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/mixed(text/plain,message/rfc822)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+
+	parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	attached := parsed.Body.Parts[1]
+	assert.Equal(t, `attachment; filename=Lunch.eml`, attached.Headers.Get("Content-Disposition"))
+	assert.Equal(t, "7bit", attached.Headers.Get("Content-Transfer-Encoding"))
+	assert.Equal(t, raw, string(attached.Body))
+}
@@ -0,0 +1,223 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers emails to an SMTP server.
+type Sender struct {
+	// Addr is the address of the SMTP server in host:port form.
+	Addr string
+
+	// Auth is the authentication mechanism, e.g. smtp.PlainAuth.
+	// If nil no authentication is performed.
+	Auth smtp.Auth
+
+	// TLSConfig is the TLS configuration used for STARTTLS.
+	// Defaults to a configuration verifying the host name of Addr.
+	TLSConfig *tls.Config
+
+	// RequireTLS makes Send fail if the server does not support
+	// STARTTLS instead of sending the message in plaintext.
+	RequireTLS bool
+
+	// Timeout is the maximum time of connecting to the server
+	// and receiving its greeting. Defaults to DefaultSendTimeout.
+	Timeout time.Duration
+
+	// LocalName is the host name sent in the EHLO command.
+	// Defaults to localhost.
+	LocalName string
+}
+
+// DefaultSendTimeout is the connection timeout of Sender
+// if its Timeout field is zero.
+const DefaultSendTimeout = 30 * time.Second
+
+func NewSender(addr string, auth smtp.Auth) *Sender {
+	return &Sender{
+		Addr: addr,
+		Auth: auth,
+	}
+}
+
+// Send delivers the email built by b. The envelope is derived
+// from the message headers by the Envelope method.
+// The Bcc header is not written to the delivered message.
+// STARTTLS is used if the server supports it.
+// It returns an error if RequireTLS is set but the server
+// does not support STARTTLS, or Auth is set but the server
+// does not support authentication.
+// The message is written to the server while it is encoded.
+func (s *Sender) Send(b *EmailBuilder) error {
+	from, to, err := b.Envelope()
+	if err != nil {
+		return err
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if s.LocalName != "" {
+		err = c.Hello(s.LocalName)
+		if err != nil {
+			return err
+		}
+	}
+
+	ok, _ := c.Extension("STARTTLS")
+	if !ok && s.RequireTLS {
+		return fmt.Errorf("smtp server %s does not support STARTTLS", s.Addr)
+	}
+	if ok {
+		config := s.TLSConfig
+		if config == nil {
+			host, _, err := net.SplitHostPort(s.Addr)
+			if err != nil {
+				return err
+			}
+			config = &tls.Config{ServerName: host}
+		}
+		err = c.StartTLS(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server %s does not support AUTH", s.Addr)
+		}
+		err = c.Auth(s.Auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		err = c.Rcpt(rcpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	// The message is written directly to the connection, so the
+	// streamed content is not held in memory. If writing fails
+	// the data is not terminated and the server discards it.
+	err = b.write(wc, "Bcc")
+	if err != nil {
+		return err
+	}
+	err = wc.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dial connects to the server and reads its greeting
+// within the timeout.
+func (s *Sender) dial() (*smtp.Client, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultSendTimeout
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := (&net.Dialer{Timeout: timeout}).Dial("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The message may take longer to send than to connect.
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Envelope returns the SMTP envelope of the email.
+// The reverse-path is the Sender address if set,
+// otherwise the first From address.
+// The recipients are the To, Cc and Bcc addresses without duplicates.
+// It returns an error if the email has no sender or recipients.
+func (b *EmailBuilder) Envelope() (from string, to []string, err error) {
+	key := "Sender"
+	if !b.Headers.Has(key) {
+		key = "From"
+	}
+	addrs, err := b.addressList(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(addrs) == 0 {
+		return "", nil, fmt.Errorf("missing From address")
+	}
+	from = addrs[0].Address
+
+	seen := make(map[string]bool)
+	for _, key := range []string{"To", "Cc", "Bcc"} {
+		addrs, err := b.addressList(key)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, a := range addrs {
+			if seen[strings.ToLower(a.Address)] {
+				continue
+			}
+			seen[strings.ToLower(a.Address)] = true
+			to = append(to, a.Address)
+		}
+	}
+	if len(to) == 0 {
+		return "", nil, fmt.Errorf("missing recipient address")
+	}
+	return from, to, nil
+}
+
+// addressList parses the addresses of all the key header fields.
+func (b *EmailBuilder) addressList(key string) ([]*mail.Address, error) {
+	var addrs []*mail.Address
+	for _, v := range b.Headers.Values(key) {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		list, err := mail.ParseAddressList(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header %q: %w", key, v, err)
+		}
+		addrs = append(addrs, list...)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,405 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpServer is a minimal in-process SMTP server
+// accepting a single message.
+type smtpServer struct {
+	l         net.Listener
+	tlsConfig *tls.Config
+	done      chan struct{}
+
+	// Recorded by the server.
+	TLS   bool
+	Auth  string
+	From  string
+	To    []string
+	Data  string
+	Error error
+}
+
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{l: l, tlsConfig: tlsConfig, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *smtpServer) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Wait waits for the session to finish.
+func (s *smtpServer) Wait() {
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+	conn, err := s.l.Accept()
+	if err != nil {
+		s.Error = err
+		return
+	}
+	defer func() { conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			s.Error = err
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(line[len(verb):])
+		switch verb {
+		case "EHLO":
+			ext := []string{"250-localhost"}
+			if s.tlsConfig != nil && !s.TLS {
+				ext = append(ext, "250-STARTTLS")
+			}
+			ext = append(ext, "250 AUTH PLAIN")
+			tp.PrintfLine("%s", strings.Join(ext, "\r\n"))
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			tc := tls.Server(conn, s.tlsConfig)
+			err = tc.Handshake()
+			if err != nil {
+				s.Error = err
+				return
+			}
+			conn = tc
+			tp = textproto.NewConn(conn)
+			s.TLS = true
+		case "AUTH":
+			fields := strings.Fields(arg)
+			creds, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			s.Auth = string(creds)
+			tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			s.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.To = append(s.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := readData(tp.R)
+			if err != nil {
+				s.Error = err
+				return
+			}
+			s.Data = data
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// readData reads the dot-stuffed message data keeping the \r\n line endings.
+func readData(r *bufio.Reader) (string, error) {
+	buf := &strings.Builder{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return buf.String(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func newTestTLSConfigs(t *testing.T) (server *tls.Config, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	client = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	return server, client
+}
+
+func newTestSenderEmail(t *testing.T) *email.EmailBuilder {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("Szakszon Péter <peter@example.com>")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com", "Bob <bob@example.com>"})
+	assert.NoError(t, err)
+	err = b.SetCc([]string{"carol@example.com", "alice@example.com"})
+	assert.NoError(t, err)
+	err = b.SetBcc([]string{"dave@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Hello")
+	b.EncodeQuotedPlain([]byte("Hello world\r\n.\r\nbye"))
+	return b
+}
+
+func TestSenderSend(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+
+	cases := []struct {
+		Name         string
+		ServerTLS    *tls.Config
+		Auth         bool
+		ExpectedTLS  bool
+		ExpectedAuth string
+	}{
+		{
+			Name:         "starttls and auth",
+			ServerTLS:    serverTLS,
+			Auth:         true,
+			ExpectedTLS:  true,
+			ExpectedAuth: "\x00user\x00secret",
+		},
+		{
+			Name: "plain",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			server := newSMTPServer(t, c.ServerTLS)
+
+			sender := email.NewSender(server.Addr(), nil)
+			sender.TLSConfig = clientTLS
+			if c.Auth {
+				sender.Auth = smtp.PlainAuth("", "user", "secret", "127.0.0.1")
+			}
+
+			b := newTestSenderEmail(t)
+			err := sender.Send(b)
+			assert.NoError(t, err)
+			server.Wait()
+			assert.NoError(t, server.Error)
+
+			assert.Equal(t, c.ExpectedTLS, server.TLS)
+			assert.Equal(t, c.ExpectedAuth, server.Auth)
+			assert.Equal(t, "peter@example.com", server.From)
+			assert.Equal(t, []string{
+				"alice@example.com",
+				"bob@example.com",
+				"carol@example.com",
+				"dave@example.com",
+			}, server.To)
+
+			msg, err := mail.ReadMessage(strings.NewReader(server.Data))
+			assert.NoError(t, err)
+			assert.Equal(t, "", msg.Header.Get("Bcc"))
+			assert.Equal(t, "alice@example.com, Bob <bob@example.com>", msg.Header.Get("To"))
+			assert.Equal(t, b.MessageID(), msg.Header.Get("Message-ID"))
+			assert.True(t, strings.HasSuffix(server.Data, "Hello world\r\n.\r\nbye\r\n"))
+
+			// The Bcc header is kept in the builder.
+			assert.Equal(t, "dave@example.com", b.Headers.Get("Bcc"))
+		})
+	}
+}
+
+func TestSenderSendAuthNotSupported(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "EHLO") {
+				tp.PrintfLine("250 localhost")
+			} else {
+				tp.PrintfLine("221 Bye")
+			}
+		}
+	}()
+
+	sender := email.NewSender(l.Addr().String(), smtp.PlainAuth("", "user", "secret", "127.0.0.1"))
+	err = sender.Send(newTestSenderEmail(t))
+	assert.Error(t, err)
+}
+
+func TestEmailBuilderEnvelope(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Headers      email.Header
+		ExpectedFrom string
+		ExpectedTo   []string
+		Error        bool
+	}{
+		{
+			Name: "from",
+			Headers: email.Header{
+				{Key: "From", Value: "Péter <peter@example.com>"},
+				{Key: "To", Value: "alice@example.com, Bob <bob@example.com>"},
+				{Key: "Bcc", Value: "BOB@example.com, carol@example.com"},
+			},
+			ExpectedFrom: "peter@example.com",
+			ExpectedTo:   []string{"alice@example.com", "bob@example.com", "carol@example.com"},
+		},
+		{
+			Name: "sender",
+			Headers: email.Header{
+				{Key: "From", Value: "alice@example.com, bob@example.com"},
+				{Key: "Sender", Value: "list@example.com"},
+				{Key: "Cc", Value: "carol@example.com"},
+			},
+			ExpectedFrom: "list@example.com",
+			ExpectedTo:   []string{"carol@example.com"},
+		},
+		{
+			Name: "missing from",
+			Headers: email.Header{
+				{Key: "To", Value: "alice@example.com"},
+			},
+			Error: true,
+		},
+		{
+			Name: "missing recipients",
+			Headers: email.Header{
+				{Key: "From", Value: "alice@example.com"},
+			},
+			Error: true,
+		},
+		{
+			Name: "invalid address",
+			Headers: email.Header{
+				{Key: "From", Value: "alice@example.com"},
+				{Key: "To", Value: "bob@"},
+			},
+			Error: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.Headers = c.Headers
+			from, to, err := b.Envelope()
+			if c.Error {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.ExpectedFrom, from)
+			assert.Equal(t, c.ExpectedTo, to)
+		})
+	}
+}
+
+func TestSenderSendWithoutRecipients(t *testing.T) {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("peter@example.com")
+	assert.NoError(t, err)
+
+	// The envelope is checked before connecting to the server.
+	err = email.NewSender("127.0.0.1:1", nil).Send(b)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "recipient")
+}
+
+func TestSenderSendRequireTLS(t *testing.T) {
+	server := newSMTPServer(t, nil)
+
+	sender := email.NewSender(server.Addr(), nil)
+	sender.RequireTLS = true
+	err := sender.Send(newTestSenderEmail(t))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "STARTTLS")
+
+	// The message is not sent in plaintext.
+	server.Wait()
+	assert.Equal(t, "", server.From)
+	assert.Equal(t, "", server.Data)
+}
+
+func TestSenderSendTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Accept the connection without sending a greeting.
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-done
+	}()
+
+	sender := email.NewSender(l.Addr().String(), nil)
+	sender.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	err = sender.Send(newTestSenderEmail(t))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+)
+
+// SMIMESigner signs email bodies with S/MIME (RFC 8551)
+// using detached PKCS #7 signatures.
+type SMIMESigner struct {
+	// Certificate is the certificate of the signer.
+	Certificate *x509.Certificate
+
+	// Key is the private key of the certificate,
+	// either an *rsa.PrivateKey or an *ecdsa.PrivateKey.
+	Key crypto.Signer
+
+	// Certificates are the additional certificates included
+	// in the signature, e.g. the intermediate CA certificates.
+	Certificates []*x509.Certificate
+}
+
+func NewSMIMESigner(cert *x509.Certificate, key crypto.Signer) *SMIMESigner {
+	return &SMIMESigner{
+		Certificate: cert,
+		Key:         key,
+	}
+}
+
+// Sign returns a multipart/signed part containing p
+// and its detached signature in an application/pkcs7-signature part.
+// The signature is computed over p in wire format.
+func (s *SMIMESigner) Sign(p *Part) (*Part, error) {
+	if s.Certificate == nil || s.Key == nil {
+		return nil, fmt.Errorf("missing S/MIME certificate or key")
+	}
+
+	content, err := p.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signPKCS7(content, s.Certificate, s.Key, s.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	sigPart := NewPart(`application/pkcs7-signature; name="smime.p7s"`)
+	sigPart.Headers.Set("Content-Disposition", `attachment; filename="smime.p7s"`)
+	sigPart.EncodeBase64(sig)
+
+	signed := NewMultipart("signed", p, sigPart)
+	signed.Headers.Set("Content-Type", `multipart/signed; protocol="application/pkcs7-signature"; micalg=sha-256`)
+	return signed, nil
+}
+
+// SMIMEEncryptor encrypts email bodies with S/MIME (RFC 8551)
+// into PKCS #7 enveloped data.
+type SMIMEEncryptor struct {
+	// Recipients are the certificates of the recipients.
+	// Only RSA keys are supported.
+	Recipients []*x509.Certificate
+}
+
+func NewSMIMEEncryptor(recipients ...*x509.Certificate) *SMIMEEncryptor {
+	return &SMIMEEncryptor{
+		Recipients: recipients,
+	}
+}
+
+// Encrypt returns an application/pkcs7-mime part containing
+// p in wire format encrypted with AES-256-CBC for the recipients.
+func (e *SMIMEEncryptor) Encrypt(p *Part) (*Part, error) {
+	content, err := p.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	enveloped, err := encryptPKCS7(content, e.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := NewPart(`application/pkcs7-mime; smime-type=enveloped-data; name="smime.p7m"`)
+	encrypted.Headers.Set("Content-Disposition", `attachment; filename="smime.p7m"`)
+	encrypted.EncodeBase64(enveloped)
+	return encrypted, nil
+}
+
+// smimeBody signs and then encrypts the body part
+// with the S/MIME signer and encryptor of the email if set.
+func (b *EmailBuilder) smimeBody(body *Part) (*Part, error) {
+	var err error
+	if b.SMIMESigner != nil {
+		body, err = b.SMIMESigner.Sign(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.SMIMEEncryptor != nil {
+		body, err = b.SMIMEEncryptor.Encrypt(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,226 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"mime"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCertificate creates a self-signed S/MIME certificate for address.
+func newTestCertificate(t *testing.T, address string, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: address},
+		EmailAddresses:        []string{address},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writePEM writes the PEM encoded der block of type typ to a temporary file.
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openssl runs the openssl command with stdin and returns its output.
+// The test is skipped if openssl is not installed.
+func openssl(t *testing.T, stdin []byte, args ...string) []byte {
+	path, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not found")
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("openssl %s: %v: %s", strings.Join(args, " "), err, stderr)
+	}
+	return out
+}
+
+func newTestSMIMEEmail(t *testing.T) *email.EmailBuilder {
+	b := email.NewEmailBuilder()
+	err := b.SetFrom("hello@example.com")
+	assert.NoError(t, err)
+	err = b.SetTo([]string{"alice@example.com"})
+	assert.NoError(t, err)
+	b.SetSubject("Számla")
+	b.EncodeQuotedPlain([]byte("Hélló world"))
+	b.Attach("invoice.pdf", []byte("%PDF-1.4"))
+	return b
+}
+
+// bodyEntity returns the body part of b in wire format.
+func bodyEntity(t *testing.T, b *email.EmailBuilder) []byte {
+	body, err := b.BodyPart()
+	assert.NoError(t, err)
+	w := &bytes.Buffer{}
+	err = body.Write(w)
+	assert.NoError(t, err)
+	return w.Bytes()
+}
+
+func TestEmailBuilderSMIMESign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		Name string
+		Key  crypto.Signer
+	}{
+		{Name: "rsa", Key: rsaKey},
+		{Name: "ecdsa", Key: ecKey},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			cert := newTestCertificate(t, "hello@example.com", c.Key)
+			b := newTestSMIMEEmail(t)
+			b.SMIMESigner = email.NewSMIMESigner(cert, c.Key)
+
+			w := &bytes.Buffer{}
+			err := b.Write(w)
+			assert.NoError(t, err)
+
+			msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t,
+				"multipart/signed(multipart/mixed(text/plain,application/pdf),application/pkcs7-signature)",
+				mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+			)
+			_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			assert.NoError(t, err)
+			assert.Equal(t, "application/pkcs7-signature", params["protocol"])
+			assert.Equal(t, "sha-256", params["micalg"])
+
+			// The signed part is the body of the unsigned message.
+			parsed, err := email.Parse(bytes.NewReader(w.Bytes()))
+			assert.NoError(t, err)
+			signed := &bytes.Buffer{}
+			err = parsed.Body.Parts[0].Write(signed)
+			assert.NoError(t, err)
+			assert.Equal(t, string(bodyEntity(t, b)), signed.String())
+
+			caFile := writePEM(t, "ca.pem", "CERTIFICATE", cert.Raw)
+			out := openssl(t, w.Bytes(), "cms", "-verify", "-CAfile", caFile, "-purpose", "any")
+			assert.Equal(t, signed.String(), string(out))
+		})
+	}
+}
+
+func TestEmailBuilderSMIMEEncrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	cert := newTestCertificate(t, "alice@example.com", key)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherCert := newTestCertificate(t, "bob@example.com", otherKey)
+
+	b := newTestSMIMEEmail(t)
+	b.SMIMEEncryptor = email.NewSMIMEEncryptor(otherCert, cert)
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, `application/pkcs7-mime; smime-type=enveloped-data; name="smime.p7m"`, msg.Header.Get("Content-Type"))
+	assert.Equal(t, "base64", msg.Header.Get("Content-Transfer-Encoding"))
+	assert.NotContains(t, w.String(), "invoice.pdf")
+
+	certFile := writePEM(t, "cert.pem", "CERTIFICATE", cert.Raw)
+	keyFile := writePEM(t, "key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	out := openssl(t, w.Bytes(), "cms", "-decrypt", "-recip", certFile, "-inkey", keyFile)
+	assert.Equal(t, string(bodyEntity(t, b)), string(out))
+}
+
+func TestEmailBuilderSMIMESignAndEncrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	cert := newTestCertificate(t, "hello@example.com", key)
+
+	b := newTestSMIMEEmail(t)
+	b.Headers.Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+	b.SMIMESigner = email.NewSMIMESigner(cert, key)
+	b.SMIMEEncryptor = email.NewSMIMEEncryptor(cert)
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(w.Bytes()))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(msg.Header.Get("Content-Type"), "application/pkcs7-mime"))
+
+	certFile := writePEM(t, "cert.pem", "CERTIFICATE", cert.Raw)
+	keyFile := writePEM(t, "key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	decrypted := openssl(t, w.Bytes(), "cms", "-decrypt", "-recip", certFile, "-inkey", keyFile)
+	assert.True(t, strings.HasPrefix(string(decrypted), "Content-Type: multipart/signed"))
+
+	out := openssl(t, decrypted, "cms", "-verify", "-CAfile", certFile, "-purpose", "any")
+	assert.Equal(t, string(bodyEntity(t, b)), string(out))
+	assert.True(t, strings.HasPrefix(string(out), `Content-Type: multipart/mixed; boundary="abc123"`))
+}
+
+func TestSMIMEErrors(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ecCert := newTestCertificate(t, "hello@example.com", ecKey)
+
+	b := newTestSMIMEEmail(t)
+	b.SMIMEEncryptor = email.NewSMIMEEncryptor(ecCert)
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	b = newTestSMIMEEmail(t)
+	b.SMIMEEncryptor = email.NewSMIMEEncryptor()
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	b = newTestSMIMEEmail(t)
+	b.SMIMESigner = email.NewSMIMESigner(ecCert, nil)
+	err = b.Write(&bytes.Buffer{})
+	assert.Error(t, err)
+}
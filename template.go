@@ -0,0 +1,117 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template renders the subject and the bodies of an email from data.
+// The HTML body is rendered with html/template,
+// so the data is escaped according to its context.
+// The templates not set are skipped.
+type Template struct {
+	// Subject renders the Subject header.
+	// The leading and trailing white space is trimmed.
+	Subject *texttemplate.Template
+
+	// Plain renders the plain text body.
+	Plain *texttemplate.Template
+
+	// HTML renders the HTML text body.
+	HTML *htmltemplate.Template
+}
+
+// NewTemplate parses the subject, plain and HTML templates.
+// The empty templates are not set.
+func NewTemplate(subject, plain, html string) (*Template, error) {
+	t := &Template{}
+	var err error
+	if subject != "" {
+		t.Subject, err = texttemplate.New("subject").Parse(subject)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if plain != "" {
+		t.Plain, err = texttemplate.New("plain").Parse(plain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if html != "" {
+		t.HTML, err = htmltemplate.New("html").Parse(html)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// LookupTemplate returns the templates of the email named name
+// in the template sets: the name.subject and name.plain templates
+// of text and the name.html template of html.
+// The sets can be nil. Parsed with ParseFS or ParseGlob
+// the templates are named after the template files,
+// e.g. welcome.subject, welcome.plain and welcome.html.
+// It returns an error if none of the templates are found.
+func LookupTemplate(text *texttemplate.Template, html *htmltemplate.Template, name string) (*Template, error) {
+	t := &Template{}
+	if text != nil {
+		t.Subject = text.Lookup(name + ".subject")
+		t.Plain = text.Lookup(name + ".plain")
+	}
+	if html != nil {
+		t.HTML = html.Lookup(name + ".html")
+	}
+	if t.Subject == nil && t.Plain == nil && t.HTML == nil {
+		return nil, fmt.Errorf("email template %s not found", name)
+	}
+	return t, nil
+}
+
+// Execute renders the templates with data into b.
+// The Subject header is set and the bodies are encoded
+// by the SetPlainBody and SetHTMLBody methods.
+// It returns an error if the subject contains a line break.
+func (t *Template) Execute(b *EmailBuilder, data interface{}) error {
+	buf := &bytes.Buffer{}
+	if t.Subject != nil {
+		err := t.Subject.Execute(buf, data)
+		if err != nil {
+			return err
+		}
+		subject := strings.TrimSpace(buf.String())
+		if strings.ContainsAny(subject, "\r\n") {
+			return fmt.Errorf("subject contains a line break: %q", subject)
+		}
+		b.SetSubject(subject)
+	}
+
+	if t.Plain != nil {
+		buf.Reset()
+		err := t.Plain.Execute(buf, data)
+		if err != nil {
+			return err
+		}
+		err = b.SetPlainBody(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.HTML != nil {
+		buf.Reset()
+		err := t.HTML.Execute(buf, data)
+		if err != nil {
+			return err
+		}
+		err = b.SetHTMLBody(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	htmltemplate "html/template"
+	"net/mail"
+	"testing"
+	"testing/fstest"
+	texttemplate "text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testOrder struct {
+	Name   string
+	Number int
+	Note   string
+}
+
+func TestTemplateExecute(t *testing.T) {
+	tmpl, err := email.NewTemplate(
+		"Order #{{.Number}} shipped\n",
+		"Dear {{.Name}},\n\nyour order has been shipped.\n{{.Note}}\n",
+		"<p>Dear {{.Name}},</p><p>your order has been shipped.</p><p>{{.Note}}</p>",
+	)
+	assert.NoError(t, err)
+
+	b := email.NewEmailBuilder()
+	err = tmpl.Execute(b, testOrder{Name: "Alice", Number: 42, Note: "<script>alert(1)</script>"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Order #42 shipped", b.Headers.Get("Subject"))
+	assert.Equal(t, "7bit", b.PlainHeaders.Get("Content-Transfer-Encoding"))
+	assert.Equal(t, "Dear Alice,\r\n\r\nyour order has been shipped.\r\n<script>alert(1)</script>\r\n", b.Plain.String())
+	assert.Contains(t, b.HTML.String(), "<p>Dear Alice,</p>")
+	assert.Contains(t, b.HTML.String(), "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>")
+
+	w := &bytes.Buffer{}
+	err = b.Write(w)
+	assert.NoError(t, err)
+	msg, err := mail.ReadMessage(w)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"multipart/alternative(text/plain,text/html)",
+		mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+	)
+}
+
+func TestLookupTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"welcome.subject": {Data: []byte("Welcome {{.Name}}")},
+		"welcome.plain":   {Data: []byte("Hello {{.Name}}")},
+		"welcome.html":    {Data: []byte("<p>Hello {{.Name}}</p>")},
+		"reset.subject":   {Data: []byte("Password reset")},
+		"reset.plain":     {Data: []byte("Reset your password")},
+	}
+	text, err := texttemplate.ParseFS(fsys, "*.subject", "*.plain")
+	assert.NoError(t, err)
+	html, err := htmltemplate.ParseFS(fsys, "*.html")
+	assert.NoError(t, err)
+
+	tmpl, err := email.LookupTemplate(text, html, "welcome")
+	assert.NoError(t, err)
+	b := email.NewEmailBuilder()
+	err = tmpl.Execute(b, testOrder{Name: "Bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Welcome Bob", b.Headers.Get("Subject"))
+	assert.Equal(t, "Hello Bob", b.Plain.String())
+	assert.Equal(t, "<p>Hello Bob</p>", b.HTML.String())
+
+	tmpl, err = email.LookupTemplate(text, html, "reset")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.HTML)
+	b = email.NewEmailBuilder()
+	err = tmpl.Execute(b, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Reset your password", b.Plain.String())
+	assert.Equal(t, 0, b.HTML.Len())
+
+	_, err = email.LookupTemplate(text, nil, "missing")
+	assert.Error(t, err)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := email.NewTemplate("{{.Name", "", "")
+	assert.Error(t, err)
+
+	_, err = email.NewTemplate("", "", "<p>{{if}}</p>")
+	assert.Error(t, err)
+
+	tmpl, err := email.NewTemplate("Hello {{.Name}}", "", "")
+	assert.NoError(t, err)
+	b := email.NewEmailBuilder()
+	err = tmpl.Execute(b, testOrder{Name: "Alice\r\nBcc: eve@example.com"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line break")
+	}
+	assert.Empty(t, b.Headers.Get("Subject"))
+
+	tmpl, err = email.NewTemplate("", "{{.Missing}}", "")
+	assert.NoError(t, err)
+	err = tmpl.Execute(email.NewEmailBuilder(), testOrder{})
+	assert.Error(t, err)
+}
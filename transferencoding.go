@@ -0,0 +1,106 @@
+package email
+
+import (
+	"bytes"
+	"mime/quotedprintable"
+)
+
+// maxLineLength is the maximum length of the lines
+// without the \r\n in 7bit data defined in RFC 2045.
+const maxLineLength = 998
+
+// TransferEncoding returns the Content-Transfer-Encoding
+// suitable for data:
+// 7bit for ASCII text with lines shorter than 998 characters,
+// base64 for binary data containing NUL bytes or bare carriage returns
+// and for text mostly made of 8-bit characters,
+// quoted-printable otherwise.
+func TransferEncoding(data []byte) string {
+	var eightBit, lineLength int
+	long := false
+	for i, c := range data {
+		switch {
+		case c == 0:
+			return "base64"
+		case c == '\r':
+			if i+1 == len(data) || data[i+1] != '\n' {
+				return "base64"
+			}
+			continue
+		case c == '\n':
+			lineLength = 0
+			continue
+		case c >= 0x80:
+			eightBit++
+		}
+		lineLength++
+		if lineLength > maxLineLength {
+			long = true
+		}
+	}
+
+	switch {
+	case eightBit == 0 && !long:
+		return "7bit"
+	// A quoted-printable encoded 8-bit character takes 3 bytes,
+	// so base64 is shorter above 1/6 ratio of 8-bit characters.
+	case eightBit*6 > len(data):
+		return "base64"
+	}
+	return "quoted-printable"
+}
+
+// SetPlainBody sets s as the plain text body converted from UTF-8
+// to the charset of the Content-Type header and encoded with the
+// Content-Transfer-Encoding selected by the TransferEncoding function.
+// The line breaks are converted to \r\n.
+// Plain buffer will be reset to be empty before encoding,
+// but the underlying storage will be retained.
+func (b *EmailBuilder) SetPlainBody(s []byte) error {
+	b.Plain.Reset()
+	b.PlainReader = nil
+	return encodeBody(&b.Plain, &b.PlainHeaders, s)
+}
+
+// SetHTMLBody sets s as the HTML text body converted from UTF-8
+// to the charset of the Content-Type header and encoded with the
+// Content-Transfer-Encoding selected by the TransferEncoding function.
+// The line breaks are converted to \r\n.
+// HTML buffer will be reset to be empty before encoding,
+// but the underlying storage will be retained.
+func (b *EmailBuilder) SetHTMLBody(s []byte) error {
+	b.HTML.Reset()
+	b.HTMLReader = nil
+	return encodeBody(&b.HTML, &b.HTMLHeaders, s)
+}
+
+// encodeBody converts s to the charset of the Content-Type header
+// in headers and writes it to w encoded with the selected
+// Content-Transfer-Encoding. The header is set in headers.
+func encodeBody(w *bytes.Buffer, headers *Header, s []byte) error {
+	s, err := encodeBodyCharset(*headers, s)
+	if err != nil {
+		return err
+	}
+	encoding := TransferEncoding(s)
+	headers.Set("Content-Transfer-Encoding", encoding)
+
+	switch encoding {
+	case "7bit":
+		_, err = w.Write(normalizeNewlines(s))
+		return err
+	case "base64":
+		encoder := newBase64Encoder(w)
+		_, err = encoder.Write(normalizeNewlines(s))
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	encoder := quotedprintable.NewWriter(w)
+	_, err = encoder.Write(s)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
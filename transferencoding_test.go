@@ -0,0 +1,95 @@
+package email_test
+
+import (
+	"github.com/szxp/email"
+
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferEncoding(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Data     string
+		Expected string
+	}{
+		{Name: "empty", Data: "", Expected: "7bit"},
+		{Name: "ascii", Data: "Hello world\r\nBye\n", Expected: "7bit"},
+		{Name: "line of 998 characters", Data: strings.Repeat("a", 998) + "\r\nb", Expected: "7bit"},
+		{Name: "long line", Data: strings.Repeat("a", 999), Expected: "quoted-printable"},
+		{Name: "few 8-bit characters", Data: "Hélló world, how are you?", Expected: "quoted-printable"},
+		{Name: "mostly 8-bit characters", Data: "Здравствуй, мир", Expected: "base64"},
+		{Name: "NUL byte", Data: "Hello\x00world", Expected: "base64"},
+		{Name: "bare carriage return", Data: "Hello\rworld", Expected: "base64"},
+		{Name: "trailing carriage return", Data: "Hello\r", Expected: "base64"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Expected, email.TransferEncoding([]byte(c.Data)))
+		})
+	}
+}
+
+func TestEmailBuilderSetBody(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Data     string
+		Expected string
+		Decode   func(r io.Reader) io.Reader
+	}{
+		{
+			Name:     "7bit",
+			Data:     "Hello world\nBye",
+			Expected: "7bit",
+			Decode:   func(r io.Reader) io.Reader { return r },
+		},
+		{
+			Name:     "quoted-printable",
+			Data:     "Hélló world, how are you?\r\nBye",
+			Expected: "quoted-printable",
+			Decode:   func(r io.Reader) io.Reader { return quotedprintable.NewReader(r) },
+		},
+		{
+			Name:     "base64",
+			Data:     "Здравствуй, мир",
+			Expected: "base64",
+			Decode:   func(r io.Reader) io.Reader { return base64.NewDecoder(base64.StdEncoding, r) },
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := email.NewEmailBuilder()
+			b.EncodeBase64Plain([]byte("previous"))
+			err := b.SetPlainBody([]byte(c.Data))
+			assert.NoError(t, err)
+			err = b.SetHTMLBody([]byte(c.Data))
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, b.PlainHeaders.Get("Content-Transfer-Encoding"))
+			assert.Equal(t, c.Expected, b.HTMLHeaders.Get("Content-Transfer-Encoding"))
+			assert.Equal(t, b.Plain.String(), b.HTML.String())
+
+			w := &bytes.Buffer{}
+			err = b.Write(w)
+			assert.NoError(t, err)
+			msg, err := mail.ReadMessage(w)
+			assert.NoError(t, err)
+			assert.Equal(t,
+				"multipart/alternative(text/plain,text/html)",
+				mimeStructure(t, msg.Header.Get("Content-Type"), msg.Body),
+			)
+
+			data, err := io.ReadAll(c.Decode(bytes.NewReader(b.Plain.Bytes())))
+			assert.NoError(t, err)
+			assert.Equal(t, strings.ReplaceAll(c.Data, "\r\n", "\n"), strings.ReplaceAll(string(data), "\r\n", "\n"))
+		})
+	}
+}